@@ -0,0 +1,359 @@
+//Package api exposes a tangle over HTTP with JSON bodies
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	tangle "tangle/tangle2"
+)
+
+const (
+	//eventBuffer is the number of events buffered for each event stream
+	eventBuffer = 1024
+
+	//statusClientClosed is reported when the client went away mid request
+	statusClientClosed = 499
+
+	//defaults of the server limits
+	defaultTimeout       = 10 * time.Second
+	defaultMaxSelections = 1000
+	defaultMaxBodySize   = 1 << 20
+)
+
+//Server handles HTTP requests for a tangle. NewServer sets its limits to
+//defaults that can be changed before it serves requests, zero disables a limit.
+type Server struct {
+	tangle *tangle.Tangle
+
+	//Timeout limits how long adding a block or selecting tips may take, the
+	//request is also cancelled when the client goes away
+	Timeout time.Duration
+
+	//MaxSelections limits the 'n' and 'max' of tip selection, requests for
+	//more are rejected
+	MaxSelections int
+
+	//MaxBodySize limits the size in bytes of the body that posts a block
+	MaxBodySize int64
+}
+
+//NewServer creates a server for the provided tangle
+func NewServer(t *tangle.Tangle) (s *Server) {
+	s = &Server{
+		tangle:        t,
+		Timeout:       defaultTimeout,
+		MaxSelections: defaultMaxSelections,
+		MaxBodySize:   defaultMaxBodySize,
+	}
+
+	return
+}
+
+//ServeHTTP routes the request to the handler for its path:
+//
+//	POST /blocks                 add a block: {"parents": [1, 2], "payload": "<base64>"}
+//	GET  /blocks/{id}            a block with its parents and metadata
+//	GET  /blocks/{id}/parents    ids of the blocks it approves
+//	GET  /blocks/{id}/children   ids of the blocks that approve it
+//	GET  /tips?n=2&max=100       tip selection
+//	GET  /stats                  number of blocks, tips and the height
+//	GET  /draw.dot               graphviz drawing of the tangle
+//	GET  /events?weights=true    stream of tangle events as server-sent events
+//	GET  /metrics                metrics in the Prometheus text format
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "blocks":
+		if allow(w, r, http.MethodPost) {
+			s.postBlock(w, r)
+		}
+
+	case len(parts) == 2 && parts[0] == "blocks":
+		if allow(w, r, http.MethodGet) {
+			s.getBlock(w, r, parts[1])
+		}
+
+	case len(parts) == 3 && parts[0] == "blocks" && (parts[2] == "parents" || parts[2] == "children"):
+		if allow(w, r, http.MethodGet) {
+			s.getEdges(w, r, parts[1], parts[2])
+		}
+
+	case len(parts) == 1 && parts[0] == "tips":
+		if allow(w, r, http.MethodGet) {
+			s.getTips(w, r)
+		}
+
+	case len(parts) == 1 && parts[0] == "stats":
+		if allow(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, s.tangle.Stats())
+		}
+
+	case len(parts) == 1 && parts[0] == "draw.dot":
+		if allow(w, r, http.MethodGet) {
+			s.getDrawing(w, r)
+		}
+
+	case len(parts) == 1 && parts[0] == "events":
+		if allow(w, r, http.MethodGet) {
+			s.getEvents(w, r)
+		}
+
+	case len(parts) == 1 && parts[0] == "metrics":
+		if allow(w, r, http.MethodGet) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+			s.tangle.Metrics().WriteTo(w)
+		}
+
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+func (s *Server) postBlock(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Parents []uint64 `json:"parents"`
+		Data    []byte   `json:"payload"`
+	}
+
+	if s.MaxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.MaxBodySize)
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("block exceeds %d bytes", mbe.Limit)})
+			return
+		}
+
+		writeError(w, badRequest{fmt.Errorf("failed to decode block: %v", err)})
+		return
+	}
+
+	if len(req.Parents) == 0 {
+		writeError(w, badRequest{errors.New("a block needs at least one parent")})
+		return
+	}
+
+	ctx, cancel := s.context(r)
+	defer cancel()
+
+	id, err := s.tangle.ReceiveBlockContext(ctx, req.Data, req.Parents...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	b, err := s.tangle.Block(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/blocks/%d", id))
+	writeJSON(w, http.StatusCreated, b)
+}
+
+func (s *Server) getBlock(w http.ResponseWriter, r *http.Request, idstr string) {
+	id, err := parseID(idstr)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	b, err := s.tangle.Block(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, b)
+}
+
+func (s *Server) getEdges(w http.ResponseWriter, r *http.Request, idstr, dir string) {
+	id, err := parseID(idstr)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	edges := s.tangle.Children
+	if dir == "parents" {
+		edges = s.tangle.Parents
+	}
+
+	ids, err := edges(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if ids == nil {
+		ids = []uint64{}
+	}
+
+	writeJSON(w, http.StatusOK, ids)
+}
+
+func (s *Server) getTips(w http.ResponseWriter, r *http.Request) {
+	n, max := 2, 100
+	for name, v := range map[string]*int{"n": &n, "max": &max} {
+		str := r.URL.Query().Get(name)
+		if str == "" {
+			continue
+		}
+
+		i, err := strconv.Atoi(str)
+		if err != nil || i < 1 {
+			writeError(w, badRequest{fmt.Errorf("'%s' must be a positive number", name)})
+			return
+		}
+
+		if s.MaxSelections > 0 && i > s.MaxSelections {
+			writeError(w, badRequest{fmt.Errorf("'%s' must not exceed %d", name, s.MaxSelections)})
+			return
+		}
+
+		*v = i
+	}
+
+	ctx, cancel := s.context(r)
+	defer cancel()
+
+	tips, err := s.tangle.SelectTipsContext(ctx, n, max)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if tips == nil {
+		tips = []uint64{}
+	}
+
+	writeJSON(w, http.StatusOK, tips)
+}
+
+//getDrawing renders the drawing before writing it, so a failure can still be
+//reported with an error status instead of a truncated body
+func (s *Server) getDrawing(w http.ResponseWriter, r *http.Request) {
+	buf := bytes.NewBuffer(nil)
+	if err := s.tangle.Draw(buf); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+func (s *Server) getEvents(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, errors.New("streaming is not supported"))
+		return
+	}
+
+	var opts []tangle.SubscribeOption
+	if r.URL.Query().Get("weights") == "true" {
+		opts = append(opts, tangle.WithWeightChanges())
+	}
+
+	events, cancel := s.tangle.Subscribe(eventBuffer, opts...)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return //after an Overflow event, the client should reconnect
+			}
+
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return
+			}
+
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+				return
+			}
+
+			f.Flush()
+		}
+	}
+}
+
+//context returns the request's context limited by the server timeout
+func (s *Server) context(r *http.Request) (context.Context, context.CancelFunc) {
+	if s.Timeout > 0 {
+		return context.WithTimeout(r.Context(), s.Timeout)
+	}
+
+	return context.WithCancel(r.Context())
+}
+
+//badRequest marks an error as caused by the client
+type badRequest struct{ error }
+
+func parseID(s string) (id uint64, err error) {
+	id, err = strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, badRequest{fmt.Errorf("invalid block id '%s'", s)}
+	}
+
+	return
+}
+
+//allow writes a 405 response if the request doesn't use the method
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+
+	w.Header().Set("Allow", method)
+	writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	return false
+}
+
+//writeError maps store and graph errors onto a status code
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if _, ok := err.(badRequest); ok {
+		status = http.StatusBadRequest
+	}
+
+	switch err {
+	case tangle.ErrBlockNotExist:
+		status = http.StatusNotFound
+	case tangle.ErrParentNotExist:
+		status = http.StatusUnprocessableEntity
+	case tangle.ErrBlockExists:
+		status = http.StatusConflict
+	case context.DeadlineExceeded:
+		status = http.StatusServiceUnavailable
+	case context.Canceled:
+		status = statusClientClosed
+	}
+
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
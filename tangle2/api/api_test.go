@@ -0,0 +1,117 @@
+package api_test
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/api"
+	"tangle/tangle2/store"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestServer(t *testing.T) {
+	srv := httptest.NewServer(api.NewServer(tangle.NewTangle(store.NewSimple())))
+	defer srv.Close()
+
+	do := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		test.Ok(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		test.Ok(t, err)
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		test.Ok(t, err)
+		return resp.StatusCode, string(data)
+	}
+
+	for _, c := range []struct {
+		method, path, body string
+		status             int
+		resp               string
+	}{
+		{"POST", "/blocks", `{"parents":[1,2],"payload":"aGVsbG8="}`, 201, `{"id":3,"parents":[1,2],"payload":"aGVsbG8=","meta":{"weight":0,"height":1}}`},
+		{"POST", "/blocks", `{"parents":[1,99]}`, 422, `{"error":"parent doesn't exist"}`},
+		{"POST", "/blocks", `{"parents":[]}`, 400, `{"error":"a block needs at least one parent"}`},
+		{"POST", "/blocks", `{`, 400, `{"error":"failed to decode block: unexpected EOF"}`},
+		{"POST", "/blocks", `{"parents":[1,2],"payload":"` + strings.Repeat("A", 1<<20) + `"}`, 413, `{"error":"block exceeds 1048576 bytes"}`},
+		{"GET", "/blocks", ``, 405, `{"error":"method not allowed"}`},
+		{"GET", "/blocks/1", ``, 200, `{"id":1,"parents":null,"payload":"AQ==","meta":{"weight":1,"height":0}}`},
+		{"GET", "/blocks/99", ``, 404, `{"error":"block doesn't exist"}`},
+		{"GET", "/blocks/abc", ``, 400, `{"error":"invalid block id 'abc'"}`},
+		{"GET", "/blocks/1/children", ``, 200, `[3]`},
+		{"GET", "/blocks/3/children", ``, 200, `[]`},
+		{"GET", "/blocks/3/parents", ``, 200, `[1,2]`},
+		{"GET", "/blocks/99/parents", ``, 404, `{"error":"block doesn't exist"}`},
+		{"GET", "/tips?n=1&max=10", ``, 200, `[3]`},
+		{"GET", "/tips?n=0", ``, 400, `{"error":"'n' must be a positive number"}`},
+		{"GET", "/tips?max=2000000000", ``, 400, `{"error":"'max' must not exceed 1000"}`},
+		{"GET", "/stats", ``, 200, `{"blocks":3,"tips":1,"genesis":2,"height":1}`},
+		{"GET", "/draw.dot", ``, 200, "digraph {\n"},
+		{"GET", "/metrics", ``, 200, "# HELP tangle_blocks_received_total"},
+		{"GET", "/foo", ``, 404, `{"error":"not found"}`},
+	} {
+		status, resp := do(c.method, c.path, c.body)
+		test.Equals(t, c.status, status)
+		test.Equals(t, true, strings.HasPrefix(resp, c.resp))
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	srv := httptest.NewServer(api.NewServer(tngl))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	test.Ok(t, err)
+	defer resp.Body.Close()
+	test.Equals(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	_, err = tngl.ReceiveBlock([]byte{0x03}, 1, 2)
+	test.Ok(t, err)
+
+	scan := bufio.NewScanner(resp.Body)
+	var lines []string
+	for len(lines) < 6 && scan.Scan() {
+		lines = append(lines, scan.Text())
+	}
+
+	test.Equals(t, []string{
+		"event: BlockAttached",
+		`data: {"type":"BlockAttached","id":3,"meta":{"weight":0,"height":1}}`,
+		"",
+		"event: TipAdded",
+		`data: {"type":"TipAdded","id":3,"meta":{"weight":0,"height":1}}`,
+		"",
+	}, lines)
+}
+
+func TestEventStreamWeights(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	srv := httptest.NewServer(api.NewServer(tngl))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events?weights=true")
+	test.Ok(t, err)
+	defer resp.Body.Close()
+
+	_, err = tngl.ReceiveBlock([]byte{0x03}, 1)
+	test.Ok(t, err)
+
+	scan := bufio.NewScanner(resp.Body)
+	var events []string
+	for len(events) < 4 && scan.Scan() {
+		if strings.HasPrefix(scan.Text(), "event: ") {
+			events = append(events, strings.TrimPrefix(scan.Text(), "event: "))
+		}
+	}
+
+	test.Equals(t, []string{"BlockAttached", "TipAdded", "TipRemoved", "WeightChanged"}, events)
+}
@@ -0,0 +1,222 @@
+package tangle
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+//batchWindow is the number of blocks for which weights are propagated at once,
+//it bounds the memory used to track the new blocks each block is approved by
+const batchWindow = 1024
+
+//BatchError is returned when a block in a batch can't be appended, none of the
+//blocks in the batch are appended in that case
+type BatchError struct {
+	ID     uint64 //block that couldn't be appended
+	Parent uint64 //parent that doesn't exist, if Err is ErrParentNotExist
+	Err    error  //ErrBlockExists or ErrParentNotExist
+}
+
+func (e *BatchError) Error() string {
+	if e.Err == ErrParentNotExist {
+		return fmt.Sprintf("block %d references unknown parent %d", e.ID, e.Parent)
+	}
+
+	return fmt.Sprintf("block %d: %v", e.ID, e.Err)
+}
+
+//ReceiveBlocks adds many blocks in one transaction. Blocks must be in
+//topological order and keep their ids so they can approve blocks earlier in
+//the batch. Heights that are larger then the parents imply are kept, weights
+//are computed. If a *BatchError is returned none of the blocks were added.
+func (t *Tangle) ReceiveBlocks(blocks []Block) (err error) {
+	defer t.metrics.receiveTime.since(time.Now())
+
+	var evs []Event
+	tx := t.begin(true)
+	err = t.receiveBlocks(tx, t.collect(&evs), blocks)
+	if err == nil {
+		t.onCommit(tx, evs...)
+	}
+
+	if cerr := tx.Commit(); cerr != nil && err == nil {
+		return fmt.Errorf("failed to commit: %v", cerr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	atomic.AddUint64(&t.metrics.blocksReceived, uint64(len(blocks)))
+	return nil
+}
+
+func (t *Tangle) receiveBlocks(tx StoreTx, emit func(Event), blocks []Block) (err error) {
+	if err = t.graph.appendBatch(tx, emit, blocks); err != nil {
+		return err
+	}
+
+	seq := tx.GetSeq()
+	for _, b := range blocks {
+		if b.ID > seq {
+			seq = b.ID
+		}
+	}
+
+	tx.SetSeq(seq)
+	return
+}
+
+//appendBatch appends blocks in topological order with known ids, weights are
+//updated once for every window of blocks instead of once for every block. The
+//graph is not modified if an error is returned.
+func (g *Graph) appendBatch(tx StoreTx, emit func(Event), blocks []Block) (err error) {
+	if emit == nil {
+		emit = func(Event) {}
+	}
+
+	inBatch := make(map[uint64]struct{}, len(blocks))
+	for _, b := range blocks {
+		if _, ok := inBatch[b.ID]; ok {
+			return &BatchError{ID: b.ID, Err: ErrBlockExists}
+		}
+
+		if _, ok := tx.GetMeta(b.ID); ok {
+			return &BatchError{ID: b.ID, Err: ErrBlockExists}
+		}
+
+		for _, pid := range b.Parents {
+			if _, ok := inBatch[pid]; ok {
+				continue
+			}
+
+			if _, ok := tx.GetMeta(pid); !ok {
+				return &BatchError{ID: b.ID, Parent: pid, Err: ErrParentNotExist}
+			}
+		}
+
+		inBatch[b.ID] = struct{}{}
+	}
+
+	tips := tx.GetTips()
+	for _, b := range blocks {
+		height := b.Meta.Height //may be larger if parents were pruned
+		for _, pid := range b.Parents {
+			pmeta, _ := tx.GetMeta(pid)
+			if nheight := pmeta.Height + 1; nheight > height {
+				height = nheight
+			}
+		}
+
+		m := Meta{Height: height}
+		tx.SetData(b.ID, b.Data)
+		tx.SetMeta(b.ID, m)
+		tx.SetTip(b.ID)
+		tips[b.ID] = struct{}{}
+		emit(Event{Type: BlockAttached, ID: b.ID, Meta: m})
+		emit(Event{Type: TipAdded, ID: b.ID, Meta: m})
+
+		for _, pid := range b.Parents {
+			if _, ok := tips[pid]; ok {
+				delete(tips, pid)
+				tx.DelTip(pid)
+				pmeta, _ := tx.GetMeta(pid)
+				emit(Event{Type: TipRemoved, ID: pid, Meta: pmeta})
+			}
+
+			tx.SetP2c(pid, append(tx.GetP2c(pid), b.ID))
+		}
+
+		if len(b.Parents) > 0 {
+			tx.SetC2p(b.ID, b.Parents)
+		}
+	}
+
+	for i := 0; i < len(blocks); i += batchWindow {
+		end := i + batchWindow
+		if end > len(blocks) {
+			end = len(blocks)
+		}
+
+		g.addWeights(tx, emit, blocks[i:end])
+	}
+
+	return
+}
+
+//addWeights increases the weight of every block by the number of blocks in
+//the window that (in)directly approve it. It tracks these as a bitset per block
+//and walks the past cone once, highest blocks first, so every block is visited
+//after all blocks approving it.
+func (g *Graph) addWeights(tx StoreTx, emit func(Event), window []Block) {
+	words := (len(window) + 63) / 64
+	pos := make(map[uint64]int, len(window))
+	for i, b := range window {
+		pos[b.ID] = i
+	}
+
+	approvers := make(map[uint64][]uint64)
+	var order []uint64
+	union := func(id uint64) (bs []uint64) {
+		bs = make([]uint64, words)
+		for _, cid := range tx.GetP2c(id) {
+			for w, x := range approvers[cid] {
+				bs[w] |= x
+			}
+		}
+
+		return
+	}
+
+	//blocks in the window approve blocks earlier in the window
+	for i := len(window) - 1; i >= 0; i-- {
+		bs := union(window[i].ID)
+		approvers[window[i].ID] = bs
+		order = append(order, window[i].ID)
+		bs[i/64] |= 1 << uint(i%64) //approves itself, which isn't counted
+	}
+
+	var past []uint64
+	for _, b := range window {
+		for _, pid := range b.Parents {
+			if _, ok := pos[pid]; !ok {
+				past = append(past, pid)
+			}
+		}
+	}
+
+	//the past cone is walked by decreasing height
+	highest := func(id uint64, m Meta) uint64 { return math.MaxUint64 - m.Height }
+	if err := g.WalkWith(context.Background(), tx, past, g.Parents, WalkOptions{Priority: highest}, func(id uint64, m Meta, la []uint64) error {
+		approvers[id] = union(id)
+		order = append(order, id)
+		return nil
+	}); err != nil {
+		panic("failed to update weights: " + err.Error())
+	}
+
+	for _, id := range order {
+		var n uint64
+		for _, x := range approvers[id] {
+			n += uint64(bits.OnesCount64(x))
+		}
+
+		if _, ok := pos[id]; ok {
+			n-- //itself
+		}
+
+		if n == 0 {
+			continue
+		}
+
+		m, _ := tx.GetMeta(id)
+		prev := m.Weight
+		m.Weight += n
+		tx.SetMeta(id, m)
+		emit(Event{Type: WeightChanged, ID: id, Meta: m, prev: prev})
+	}
+}
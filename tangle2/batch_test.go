@@ -0,0 +1,83 @@
+package tangle_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/store"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestReceiveBlocks(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	tngl := tangle.NewTangle(store.NewSimple())
+	ids := tngl.Genesis()
+	for i := 0; i < 1500; i++ { //spans multiple weight windows
+		recent := ids
+		if len(recent) > 20 {
+			recent = recent[len(recent)-20:]
+		}
+
+		var parents []uint64
+		for j := 0; j < 1+rnd.Intn(2); j++ {
+			parents = append(parents, recent[rnd.Intn(len(recent))])
+		}
+
+		ids = append(ids, receive(t, tngl, []byte{byte(i)}, parents...))
+	}
+
+	var blocks []tangle.Block
+	for _, id := range ids[2:] {
+		b, err := tngl.Block(id)
+		test.Ok(t, err)
+		blocks = append(blocks, b)
+	}
+
+	t.Run("same as one by one", func(t *testing.T) {
+		tngl2 := tangle.NewTangle(store.NewSimple())
+		test.Ok(t, tngl2.ReceiveBlocks(blocks))
+
+		exp, act := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+		test.Ok(t, tngl.Export(exp))
+		test.Ok(t, tngl2.Export(act))
+		test.Equals(t, exp.String(), act.String())
+		test.Equals(t, ids[len(ids)-1]+1, receive(t, tngl2, []byte{}, 1))
+	})
+
+	t.Run("nothing added on error", func(t *testing.T) {
+		tngl2 := tangle.NewTangle(store.NewSimple())
+		err := tngl2.ReceiveBlocks([]tangle.Block{blocks[0], {ID: 99, Parents: []uint64{98}}})
+		test.Equals(t, &tangle.BatchError{ID: 99, Parent: 98, Err: tangle.ErrParentNotExist}, err)
+		test.Equals(t, "block 99 references unknown parent 98", err.Error())
+
+		err = tngl2.ReceiveBlocks([]tangle.Block{blocks[0], blocks[0]})
+		test.Equals(t, &tangle.BatchError{ID: blocks[0].ID, Err: tangle.ErrBlockExists}, err)
+		test.Equals(t, 2, tngl2.Stats().Blocks)
+	})
+}
+
+func TestReceiveBlocksConfirms(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	tngl.SetConfirmationWeight(2)
+
+	events, cancel := tngl.Subscribe(100)
+	test.Ok(t, tngl.ReceiveBlocks([]tangle.Block{
+		{ID: 3, Parents: []uint64{1}},
+		{ID: 4, Parents: []uint64{3}},
+		{ID: 5, Parents: []uint64{4}},
+	}))
+	cancel()
+
+	var confirmed []uint64
+	for e := range events {
+		if e.Type == tangle.Confirmed {
+			confirmed = append(confirmed, e.ID)
+		}
+	}
+
+	//weight of block 1 jumped from 0 to 3 and still got confirmed
+	test.Equals(t, []uint64{3, 1}, confirmed)
+}
@@ -0,0 +1,252 @@
+//Command tangle inspects and manipulates a tangle that is kept in a snapshot file
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/store"
+)
+
+const usage = `usage: tangle [-f file] <command> [arguments]
+
+commands:
+  init [-seed 42] [-genesis 2]                         create a new tangle
+  add [-parents 1,2] [-data payload]                   add a block and print its id
+  tips [-n 2] [-max 100]                               select tips
+  get <id>                                             print a block as JSON
+  draw [-format dot] [-labels] [-rank height|arrival]  draw as dot, svg, graphml, gexf or d3
+  stats                                                print the number of blocks, tips and height
+  export                                               write all blocks as JSON Lines
+  import [-seed 42] [-genesis 2] [file]                create a tangle from JSON Lines
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "tangle: "+err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) (err error) {
+	fs := flag.NewFlagSet("tangle", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	path := fs.String("f", "tangle.snap", "snapshot file that holds the tangle")
+	if err = fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errors.New("no command provided")
+	}
+
+	cmd, args := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "init", "import":
+		if _, err = os.Stat(*path); err == nil {
+			return fmt.Errorf("%s already exists", *path)
+		}
+
+		cfs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+		seed := cfs.Int64("seed", 42, "seed of the random tip selection")
+		ngenesis := cfs.Int("genesis", 2, "number of genesis blocks")
+		if err = cfs.Parse(args); err != nil {
+			return err
+		}
+
+		if *ngenesis < 1 {
+			return errors.New("a tangle needs at least one genesis block")
+		}
+
+		opts := []tangle.Option{tangle.WithSeed(*seed), tangle.WithGenesisCount(*ngenesis)}
+		if cmd == "init" {
+			return save(*path, tangle.NewTangle(store.NewSimple(), opts...))
+		}
+
+		r := stdin
+		if cfs.NArg() > 0 {
+			f, err := os.Open(cfs.Arg(0))
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %v", cfs.Arg(0), err)
+			}
+
+			defer f.Close()
+			r = f
+		}
+
+		t, err := tangle.Import(store.NewSimple(), r, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to import: %v", err)
+		}
+
+		return save(*path, t)
+	}
+
+	t, err := load(*path)
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "add":
+		cfs := flag.NewFlagSet("add", flag.ContinueOnError)
+		parents := cfs.String("parents", "", "comma separated ids of the parent blocks")
+		data := cfs.String("data", "", "payload of the block")
+		if err = cfs.Parse(args); err != nil {
+			return err
+		}
+
+		var pids []uint64
+		for _, s := range strings.Split(*parents, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+
+			pid, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid parent id '%s': %v", s, err)
+			}
+
+			pids = append(pids, pid)
+		}
+
+		if len(pids) == 0 {
+			return errors.New("a block needs at least one parent")
+		}
+
+		id, err := t.ReceiveBlock([]byte(*data), pids...)
+		if err != nil {
+			return fmt.Errorf("failed to add block: %v", err)
+		}
+
+		fmt.Fprintln(stdout, id)
+		return save(*path, t)
+
+	case "tips":
+		cfs := flag.NewFlagSet("tips", flag.ContinueOnError)
+		n := cfs.Int("n", 2, "number of unique tips to select")
+		max := cfs.Int("max", 100, "maximum number of walks to perform")
+		if err = cfs.Parse(args); err != nil {
+			return err
+		}
+
+		for _, id := range t.SelectTips(*n, *max) {
+			fmt.Fprintln(stdout, id)
+		}
+
+	case "get":
+		if len(args) != 1 {
+			return errors.New("get requires exactly one block id")
+		}
+
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid block id '%s': %v", args[0], err)
+		}
+
+		b, err := t.Block(id)
+		if err != nil {
+			return fmt.Errorf("failed to get block %d: %v", id, err)
+		}
+
+		return json.NewEncoder(stdout).Encode(b)
+
+	case "draw":
+		cfs := flag.NewFlagSet("draw", flag.ContinueOnError)
+		format := cfs.String("format", "dot", "output format: dot, svg, graphml, gexf or d3")
+		labels := cfs.Bool("labels", false, "label blocks with their weight and height")
+		rank := cfs.String("rank", "", "place blocks left to right by 'height' or 'arrival'")
+		if err = cfs.Parse(args); err != nil {
+			return err
+		}
+
+		o := tangle.DrawOptions{Labels: *labels}
+		switch *rank {
+		case "":
+		case "height":
+			o.Rank = tangle.RankHeight
+		case "arrival":
+			o.Rank = tangle.RankArrival
+		default:
+			return fmt.Errorf("unknown rank '%s'", *rank)
+		}
+
+		switch *format {
+		case "dot":
+			return t.DrawWith(stdout, o)
+		case "svg":
+			return t.DrawSVG(stdout, o)
+		case "graphml":
+			return t.WriteGraphML(stdout)
+		case "gexf":
+			return t.WriteGEXF(stdout)
+		case "d3":
+			return t.WriteD3(stdout)
+		default:
+			return fmt.Errorf("unknown format '%s'", *format)
+		}
+
+	case "stats":
+		s := t.Stats()
+		fmt.Fprintf(stdout, "blocks:  %d\ntips:    %d\ngenesis: %d\nheight:  %d\n", s.Blocks, s.Tips, s.Genesis, s.Height)
+
+	case "export":
+		return t.Export(stdout)
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command '%s'", cmd)
+	}
+
+	return nil
+}
+
+//load reads the tangle from a snapshot file
+func load(path string) (t *tangle.Tangle, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s (use 'init' to create it): %v", path, err)
+	}
+
+	defer f.Close()
+	t, err = tangle.ReadSnapshot(store.NewSimple(), f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	return
+}
+
+//save atomically replaces the snapshot file with the tangle
+func save(path string, t *tangle.Tangle) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+
+	defer os.Remove(f.Name())
+	if err = t.WriteSnapshot(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write snapshot: %v", err)
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync snapshot: %v", err)
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %v", err)
+	}
+
+	return os.Rename(f.Name(), path)
+}
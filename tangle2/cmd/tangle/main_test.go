@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestCommands(t *testing.T) {
+	dir, err := os.MkdirTemp("", "tangle_")
+	test.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "t.snap")
+	exec := func(stdin string, args ...string) (string, error) {
+		out := bytes.NewBuffer(nil)
+		err := run(append([]string{"-f", path}, args...), strings.NewReader(stdin), out)
+		return out.String(), err
+	}
+
+	_, err = exec("", "tips")
+	test.Equals(t, true, err != nil) //not initialized
+
+	_, err = exec("", "init")
+	test.Ok(t, err)
+
+	_, err = exec("", "init")
+	test.Equals(t, true, err != nil) //already initialized
+
+	out, err := exec("", "add", "--parents", "1,2", "--data", "hello")
+	test.Ok(t, err)
+	test.Equals(t, "3\n", out)
+
+	_, err = exec("", "add", "--parents", "1,99")
+	test.Equals(t, "failed to add block: parent doesn't exist", err.Error())
+
+	out, err = exec("", "tips", "-n", "1")
+	test.Ok(t, err)
+	test.Equals(t, "3\n", out)
+
+	out, err = exec("", "get", "3")
+	test.Ok(t, err)
+	test.Equals(t, `{"id":3,"parents":[1,2],"payload":"aGVsbG8=","meta":{"weight":0,"height":1}}`+"\n", out)
+
+	out, err = exec("", "stats")
+	test.Ok(t, err)
+	test.Equals(t, "blocks:  3\ntips:    1\ngenesis: 2\nheight:  1\n", out)
+
+	out, err = exec("", "draw", "-format", "svg")
+	test.Ok(t, err)
+	test.Equals(t, true, strings.HasPrefix(out, "<svg"))
+
+	exported, err := exec("", "export")
+	test.Ok(t, err)
+	test.Equals(t, 3, strings.Count(exported, "\n"))
+
+	path = filepath.Join(dir, "t2.snap")
+	_, err = exec(exported, "import")
+	test.Ok(t, err)
+
+	out, err = exec("", "export")
+	test.Ok(t, err)
+	test.Equals(t, exported, out)
+
+	path = filepath.Join(dir, "t3.snap")
+	_, err = exec("", "init", "-seed", "7", "-genesis", "3")
+	test.Ok(t, err)
+
+	out, err = exec("", "stats")
+	test.Ok(t, err)
+	test.Equals(t, "blocks:  3\ntips:    3\ngenesis: 3\nheight:  0\n", out)
+}
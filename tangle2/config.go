@@ -0,0 +1,83 @@
+package tangle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	//ErrNoTangle is returned when opening a store that doesn't hold a tangle
+	ErrNoTangle = errors.New("store doesn't hold a tangle")
+
+	//ErrConfigMismatch is returned when opening a store that holds a tangle
+	//that was created with a different config
+	ErrConfigMismatch = errors.New("store holds a tangle with a different config")
+
+	//ErrTangleExists is returned when creating a tangle in a store that
+	//already holds one, it should be opened with OpenTangle instead
+	ErrTangleExists = errors.New("store already holds a tangle, use OpenTangle")
+)
+
+//Config holds the parameters a tangle was created with, only tangles with the
+//same config can exchange blocks
+type Config struct {
+	Seed    int64    `json:"seed"`    //seed of the random tip selection
+	Genesis [][]byte `json:"genesis"` //payloads of the genesis blocks
+}
+
+//Option changes the config a tangle is created or opened with
+type Option func(c *Config)
+
+//WithSeed sets the seed of the random tip selection
+func WithSeed(seed int64) Option {
+	return func(c *Config) { c.Seed = seed }
+}
+
+//WithGenesis sets the payloads of the genesis blocks, one block is created for
+//each payload
+func WithGenesis(payloads ...[]byte) Option {
+	return func(c *Config) { c.Genesis = payloads }
+}
+
+//WithGenesisCount creates 'n' genesis blocks that are numbered from one, the
+//default is two blocks with payloads 0x01 and 0x02
+func WithGenesisCount(n int) Option {
+	return func(c *Config) {
+		c.Genesis = make([][]byte, n)
+		for i := range c.Genesis {
+			buf := make([]byte, binary.MaxVarintLen64)
+			c.Genesis[i] = buf[:binary.PutUvarint(buf, uint64(i+1))]
+		}
+	}
+}
+
+//defaultConfig is used by tangles that are created without options
+func defaultConfig() Config {
+	return Config{Seed: 42, Genesis: [][]byte{{0x01}, {0x02}}}
+}
+
+//newConfig applies the options to the default config
+func newConfig(opts []Option) (c Config) {
+	c = defaultConfig()
+	for _, o := range opts {
+		o(&c)
+	}
+
+	return
+}
+
+//Equal returns whether both configs hold the same parameters
+func (c Config) Equal(o Config) bool {
+	if c.Seed != o.Seed || len(c.Genesis) != len(o.Genesis) {
+		return false
+	}
+
+	for i := range c.Genesis {
+		if !bytes.Equal(c.Genesis[i], o.Genesis[i]) {
+			return false
+		}
+	}
+
+	return true
+}
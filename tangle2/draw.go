@@ -0,0 +1,222 @@
+package tangle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+)
+
+//RankBy determines how blocks are placed from left to right in a drawing
+type RankBy int
+
+const (
+	//RankNone leaves the placement of blocks to the renderer
+	RankNone RankBy = iota
+
+	//RankHeight places blocks of equal height in the same column
+	RankHeight
+
+	//RankArrival places every block in its own column in the order they arrived
+	RankArrival
+)
+
+//DrawOptions configure what and how the tangle is drawn
+type DrawOptions struct {
+	Labels      bool                //label blocks with their id, weight and height
+	Rank        RankBy              //place blocks from left to right
+	Confirmed   map[uint64]struct{} //blocks to color as confirmed
+	Conflicting map[uint64]struct{} //blocks to color as conflicting
+	Around      []uint64            //if not empty only draw blocks close to these
+	Radius      int                 //number of edges a block can be away from 'Around'
+}
+
+//drawNode is a block as it is drawn
+type drawNode struct {
+	id       uint64
+	meta     Meta
+	children []uint64
+	tip      bool
+	color    string
+}
+
+//Draw the tangle, mainly for debugging purposes
+func (t *Tangle) Draw(w io.Writer) (err error) {
+	return t.DrawWith(w, DrawOptions{})
+}
+
+//DrawWith draws the tangle in the graphviz DOT format as configured by 'o'
+func (t *Tangle) DrawWith(w io.Writer, o DrawOptions) (err error) {
+	tx := t.begin(false)
+	defer t.mustCommit(tx)
+
+	nodes, err := t.drawNodes(tx, o)
+	if err != nil {
+		return err
+	}
+
+	ew := &errWriter{w: w}
+	w = ew
+
+	fmt.Fprintln(w, `digraph {`)
+	if o.Rank != RankNone {
+		fmt.Fprintln(w, "\t"+`rankdir=LR;`)
+	}
+
+	for _, n := range nodes {
+		attrs := `shape=box`
+		if o.Labels {
+			attrs += fmt.Sprintf(`, label="%d\nw:%d h:%d"`, n.id, n.meta.Weight, n.meta.Height)
+		}
+
+		if n.color != "" {
+			attrs += fmt.Sprintf(`, style=filled, fillcolor=%s`, n.color)
+		}
+
+		fmt.Fprintf(w, "\t"+`"%d" [%s];`+"\n", n.id, attrs)
+		for _, c := range n.children {
+			fmt.Fprintf(w, "\t"+`"%d" -> "%d";`+"\n", n.id, c)
+		}
+	}
+
+	switch o.Rank {
+	case RankHeight: //all blocks of the same height in one column
+		var ranks [][]uint64
+		for _, n := range nodes {
+			for uint64(len(ranks)) <= n.meta.Height {
+				ranks = append(ranks, nil)
+			}
+
+			ranks[n.meta.Height] = append(ranks[n.meta.Height], n.id)
+		}
+
+		for _, ids := range ranks {
+			if len(ids) == 0 {
+				continue
+			}
+
+			fmt.Fprint(w, "\t{rank=same;")
+			for _, id := range ids {
+				fmt.Fprintf(w, ` "%d";`, id)
+			}
+
+			fmt.Fprintln(w, "}")
+		}
+
+	case RankArrival: //ids are handed out on arrival, chain them invisibly
+		for _, pair := range arrivalPairs(nodes) {
+			fmt.Fprintf(w, "\t"+`"%d" -> "%d" [style=invis];`+"\n", pair[0], pair[1])
+		}
+	}
+
+	fmt.Fprintln(w, `}`)
+	if ew.err != nil {
+		return fmt.Errorf("failed to write drawing: %v", ew.err)
+	}
+
+	return
+}
+
+//errWriter keeps the first error of writing to 'w' and skips later writes
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) Write(p []byte) (n int, err error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+
+	n, ew.err = ew.w.Write(p)
+	return n, ew.err
+}
+
+//drawNodes returns the blocks to draw in topological order with the edges to
+//their children that are drawn as well
+func (t *Tangle) drawNodes(tx StoreTx, o DrawOptions) (nodes []drawNode, err error) {
+	var only map[uint64]struct{}
+	if len(o.Around) > 0 {
+		only = t.around(tx, o.Around, o.Radius)
+	}
+
+	genesis := make(map[uint64]struct{})
+	for _, id := range tx.GetGenesis() {
+		genesis[id] = struct{}{}
+	}
+
+	tips := tx.GetTips()
+	if err = t.graph.Topo(tx, tx.GetGenesis(), func(id uint64, m Meta, la []uint64) error {
+		if _, ok := only[id]; only != nil && !ok {
+			return nil
+		}
+
+		_, tip := tips[id]
+		n := drawNode{id: id, meta: m, tip: tip}
+		for _, c := range la {
+			if _, ok := only[c]; only == nil || ok {
+				n.children = append(n.children, c)
+			}
+		}
+
+		if _, ok := o.Conflicting[id]; ok {
+			n.color = "salmon"
+		} else if _, ok := o.Confirmed[id]; ok {
+			n.color = "palegreen"
+		} else if _, ok := genesis[id]; ok {
+			n.color = "lightgrey"
+		} else if tip {
+			n.color = "lightblue"
+		}
+
+		nodes = append(nodes, n)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to walk: %v", err)
+	}
+
+	return
+}
+
+//around returns the blocks that are at most 'radius' edges away from 'ids'
+func (t *Tangle) around(tx StoreTx, ids []uint64, radius int) (blocks map[uint64]struct{}) {
+	blocks = make(map[uint64]struct{})
+	var start []uint64
+	for _, id := range ids {
+		if _, ok := tx.GetMeta(id); ok {
+			blocks[id] = struct{}{}
+			start = append(start, id)
+		}
+	}
+
+	if radius < 1 {
+		return
+	}
+
+	if err := t.graph.WalkWith(context.Background(), tx, start, func(tx StoreTx, id uint64) (next []uint64) {
+		next = append(next, t.graph.Parents(tx, id)...)
+		return append(next, t.graph.Children(tx, id)...)
+	}, WalkOptions{MaxDepth: radius}, func(id uint64, m Meta, la []uint64) error {
+		blocks[id] = struct{}{}
+		return nil
+	}); err != nil {
+		panic("failed to walk around blocks: " + err.Error())
+	}
+
+	return
+}
+
+//arrivalPairs returns consecutive pairs of drawn blocks ordered by arrival
+func arrivalPairs(nodes []drawNode) (pairs [][2]uint64) {
+	ids := make([]uint64, len(nodes))
+	for i, n := range nodes {
+		ids[i] = n.id
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i := 1; i < len(ids); i++ {
+		pairs = append(pairs, [2]uint64{ids[i-1], ids[i]})
+	}
+
+	return
+}
@@ -0,0 +1,126 @@
+package tangle_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/store"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestDrawOptions(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	id3 := receive(t, tngl, []byte{0x03}, 1, 2)
+	id4 := receive(t, tngl, []byte{0x04}, id3)
+	receive(t, tngl, []byte{0x05}, id4)
+
+	t.Run("default", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		test.Ok(t, tngl.Draw(buf))
+		test.Equals(t, `digraph {
+	"1" [shape=box, style=filled, fillcolor=lightgrey];
+	"1" -> "3";
+	"2" [shape=box, style=filled, fillcolor=lightgrey];
+	"2" -> "3";
+	"3" [shape=box];
+	"3" -> "4";
+	"4" [shape=box];
+	"4" -> "5";
+	"5" [shape=box, style=filled, fillcolor=lightblue];
+}
+`, buf.String())
+	})
+
+	t.Run("labels, states and height ranks", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		test.Ok(t, tngl.DrawWith(buf, tangle.DrawOptions{
+			Labels:      true,
+			Rank:        tangle.RankHeight,
+			Confirmed:   map[uint64]struct{}{1: {}, 3: {}},
+			Conflicting: map[uint64]struct{}{4: {}},
+		}))
+
+		test.Equals(t, `digraph {
+	rankdir=LR;
+	"1" [shape=box, label="1\nw:3 h:0", style=filled, fillcolor=palegreen];
+	"1" -> "3";
+	"2" [shape=box, label="2\nw:3 h:0", style=filled, fillcolor=lightgrey];
+	"2" -> "3";
+	"3" [shape=box, label="3\nw:2 h:1", style=filled, fillcolor=palegreen];
+	"3" -> "4";
+	"4" [shape=box, label="4\nw:1 h:2", style=filled, fillcolor=salmon];
+	"4" -> "5";
+	"5" [shape=box, label="5\nw:0 h:3", style=filled, fillcolor=lightblue];
+	{rank=same; "1"; "2";}
+	{rank=same; "3";}
+	{rank=same; "4";}
+	{rank=same; "5";}
+}
+`, buf.String())
+	})
+
+	t.Run("subgraph by arrival", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		test.Ok(t, tngl.DrawWith(buf, tangle.DrawOptions{
+			Rank:   tangle.RankArrival,
+			Around: []uint64{id4},
+			Radius: 1,
+		}))
+
+		test.Equals(t, `digraph {
+	rankdir=LR;
+	"3" [shape=box];
+	"3" -> "4";
+	"4" [shape=box];
+	"4" -> "5";
+	"5" [shape=box, style=filled, fillcolor=lightblue];
+	"3" -> "4" [style=invis];
+	"4" -> "5" [style=invis];
+}
+`, buf.String())
+	})
+}
+
+func TestDrawSVG(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	receive(t, tngl, []byte{0x03}, 1, 2)
+
+	buf := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.DrawSVG(buf, tangle.DrawOptions{}))
+	test.Equals(t, `<svg xmlns="http://www.w3.org/2000/svg" width="180" height="116" viewBox="0 0 180 116">
+	<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto"><path d="M 0 0 L 10 5 L 0 10 z"/></marker></defs>
+	<line x1="70" y1="33" x2="110" y2="58" stroke="black" marker-end="url(#arrow)"/>
+	<line x1="70" y1="83" x2="110" y2="58" stroke="black" marker-end="url(#arrow)"/>
+	<rect x="20" y="20" width="50" height="26" fill="lightgrey" stroke="black"/>
+	<text x="45" y="37" text-anchor="middle" font-family="monospace" font-size="12">1</text>
+	<rect x="20" y="70" width="50" height="26" fill="lightgrey" stroke="black"/>
+	<text x="45" y="87" text-anchor="middle" font-family="monospace" font-size="12">2</text>
+	<rect x="110" y="45" width="50" height="26" fill="lightblue" stroke="black"/>
+	<text x="135" y="62" text-anchor="middle" font-family="monospace" font-size="12">3</text>
+</svg>
+`, buf.String())
+}
+
+//failingWriter fails once 'n' bytes were written
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n -= len(p); w.n < 0 {
+		return 0, errors.New("disk full")
+	}
+
+	return len(p), nil
+}
+
+func TestDrawWriteError(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	receive(t, tngl, []byte{0x03}, 1, 2)
+
+	err := tngl.Draw(&failingWriter{n: 20})
+	test.Equals(t, "failed to write drawing: disk full", err.Error())
+	err = tngl.DrawSVG(&failingWriter{n: 20}, tangle.DrawOptions{})
+	test.Equals(t, "failed to write drawing: disk full", err.Error())
+}
@@ -0,0 +1,166 @@
+package tangle
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+//EventType identifies what happened in the tangle
+type EventType int
+
+const (
+	//BlockAttached is emitted when a new block was added to the tangle
+	BlockAttached EventType = iota
+
+	//TipAdded is emitted when a block became a tip
+	TipAdded
+
+	//TipRemoved is emitted when a tip was approved and is no longer a tip
+	TipRemoved
+
+	//WeightChanged is emitted when a new block (in)directly approved a block
+	WeightChanged
+
+	//Confirmed is emitted when the weight of a block reached the confirmation weight
+	Confirmed
+
+	//Overflow is the last event of a subscriber that didn't keep up, the
+	//channel is closed after it and the subscriber should resync
+	Overflow
+)
+
+var eventTypes = []string{"BlockAttached", "TipAdded", "TipRemoved", "WeightChanged", "Confirmed", "Overflow"}
+
+func (et EventType) String() string {
+	if et < 0 || int(et) >= len(eventTypes) {
+		return "Unknown"
+	}
+
+	return eventTypes[et]
+}
+
+//MarshalText encodes the event type by its name
+func (et EventType) MarshalText() ([]byte, error) {
+	return []byte(et.String()), nil
+}
+
+//Event describes a change to a block in the tangle
+type Event struct {
+	Type EventType `json:"type"`
+	ID   uint64    `json:"id"`
+	Meta Meta      `json:"meta"`
+
+	prev uint64 //weight before a WeightChanged event
+}
+
+//bus fans events out to subscribers
+type bus struct {
+	subs map[*subscriber]struct{}
+	mu   sync.Mutex
+}
+
+//subscriber receives events on a channel that has room for one more event
+//than its buffer, that room is kept for the Overflow event
+type subscriber struct {
+	c       chan Event
+	buf     int
+	weights bool //receive WeightChanged events
+}
+
+//SubscribeOption configures a subscription
+type SubscribeOption func(s *subscriber)
+
+//WithWeightChanges also sends WeightChanged events, a block causes one for
+//every block it (in)directly approves so these are not sent by default
+func WithWeightChanges() SubscribeOption {
+	return func(s *subscriber) { s.weights = true }
+}
+
+//Subscribe returns a channel that receives events after the changes are
+//committed, it holds up to 'buf' events that weren't received yet. If the
+//subscriber doesn't keep up it receives an Overflow event and the channel is
+//closed. Calling cancel stops the subscription and closes the channel.
+func (t *Tangle) Subscribe(buf int, opts ...SubscribeOption) (events <-chan Event, cancel func()) {
+	s := &subscriber{c: make(chan Event, buf+1), buf: buf}
+	for _, o := range opts {
+		o(s)
+	}
+
+	t.events.mu.Lock()
+	if t.events.subs == nil {
+		t.events.subs = make(map[*subscriber]struct{})
+	}
+
+	t.events.subs[s] = struct{}{}
+	t.events.mu.Unlock()
+
+	return s.c, func() {
+		t.events.mu.Lock()
+		defer t.events.mu.Unlock()
+		if _, ok := t.events.subs[s]; ok {
+			delete(t.events.subs, s)
+			close(s.c)
+		}
+	}
+}
+
+//SetConfirmationWeight configures the weight at which a Confirmed event is
+//emitted for a block, zero (the default) disables confirmation events
+func (t *Tangle) SetConfirmationWeight(w uint64) {
+	atomic.StoreUint64(&t.confirmAt, w)
+}
+
+//collect returns a function that gathers events, Confirmed events are added
+//for blocks that reach the confirmation weight. WeightChanged events are only
+//gathered if a subscriber receives them.
+func (t *Tangle) collect(evs *[]Event) func(ev Event) {
+	confirmAt := atomic.LoadUint64(&t.confirmAt)
+	weights := t.events.weights()
+	return func(ev Event) {
+		prev := ev.prev
+		ev.prev = 0
+		if ev.Type != WeightChanged || weights {
+			*evs = append(*evs, ev)
+		}
+
+		if ev.Type == WeightChanged && confirmAt > 0 && prev < confirmAt && ev.Meta.Weight >= confirmAt {
+			*evs = append(*evs, Event{Type: Confirmed, ID: ev.ID, Meta: ev.Meta})
+		}
+	}
+}
+
+//weights reports if any subscriber receives WeightChanged events
+func (b *bus) weights() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		if s.weights {
+			return true
+		}
+	}
+
+	return false
+}
+
+//publish sends events to all subscribers without blocking, subscribers that
+//are full receive an Overflow event and are removed
+func (b *bus) publish(evs ...Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		for _, ev := range evs {
+			if ev.Type == WeightChanged && !s.weights {
+				continue
+			}
+
+			if len(s.c) >= s.buf {
+				s.c <- Event{Type: Overflow}
+				delete(b.subs, s)
+				close(s.c)
+				break
+			}
+
+			s.c <- ev
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package tangle_test
+
+import (
+	"sync"
+	"testing"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/store"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestEvents(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	tngl.SetConfirmationWeight(2)
+
+	events, cancel := tngl.Subscribe(100, tangle.WithWeightChanges())
+	id3 := receive(t, tngl, []byte{0x03}, 1, 2)
+	receive(t, tngl, []byte{0x04}, id3)
+	cancel()
+	cancel() //should be safe to call twice
+
+	type ev struct {
+		Type tangle.EventType
+		ID   uint64
+		W    uint64
+	}
+
+	var act []ev
+	for e := range events {
+		act = append(act, ev{e.Type, e.ID, e.Meta.Weight})
+	}
+
+	test.Equals(t, []ev{
+		{tangle.BlockAttached, 3, 0},
+		{tangle.TipAdded, 3, 0},
+		{tangle.TipRemoved, 1, 0},
+		{tangle.TipRemoved, 2, 0},
+		{tangle.WeightChanged, 1, 1},
+		{tangle.WeightChanged, 2, 1},
+		{tangle.BlockAttached, 4, 0},
+		{tangle.TipAdded, 4, 0},
+		{tangle.TipRemoved, 3, 0},
+		{tangle.WeightChanged, 3, 1},
+		{tangle.WeightChanged, 1, 2},
+		{tangle.Confirmed, 1, 2},
+		{tangle.WeightChanged, 2, 2},
+		{tangle.Confirmed, 2, 2},
+	}, act)
+
+	test.Equals(t, "TipRemoved", tangle.TipRemoved.String())
+}
+
+func TestEventsWithoutWeights(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	tngl.SetConfirmationWeight(1)
+
+	events, cancel := tngl.Subscribe(100)
+	receive(t, tngl, []byte{0x03}, 1)
+	cancel()
+
+	var act []tangle.EventType
+	for e := range events {
+		act = append(act, e.Type)
+	}
+
+	test.Equals(t, []tangle.EventType{tangle.BlockAttached, tangle.TipAdded, tangle.TipRemoved, tangle.Confirmed}, act)
+}
+
+func TestEventsOverflow(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	events, cancel := tngl.Subscribe(3)
+	defer cancel()
+
+	receive(t, tngl, []byte{0x03}, 1, 2) //4 events
+	receive(t, tngl, []byte{0x04}, 1, 2) //not received anymore
+
+	var act []tangle.EventType
+	for e := range events {
+		act = append(act, e.Type)
+	}
+
+	//the subscriber sees what fit and is then told it missed events
+	test.Equals(t, []tangle.EventType{tangle.BlockAttached, tangle.TipAdded, tangle.TipRemoved, tangle.Overflow}, act)
+	cancel() //safe after the channel was closed
+}
+
+func TestEventsInCommitOrder(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	events, cancel := tngl.Subscribe(10000)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := tngl.ReceiveBlock([]byte{}, tngl.SelectTips(2, 10)...); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	test.Ok(t, <-errs)
+	cancel()
+
+	//replaying the events results in the tips of the tangle, a tip is only
+	//removed after it was added
+	tips := map[uint64]bool{1: true, 2: true}
+	for e := range events {
+		switch e.Type {
+		case tangle.TipAdded:
+			tips[e.ID] = true
+		case tangle.TipRemoved:
+			test.Equals(t, true, tips[e.ID])
+			delete(tips, e.ID)
+		}
+	}
+
+	test.Equals(t, tngl.Stats().Tips, len(tips))
+}
@@ -0,0 +1,99 @@
+package tangle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+//Block is a block together with its parents and metadata as it is exchanged
+//with other tangles
+type Block struct {
+	ID      uint64   `json:"id"`
+	Parents []uint64 `json:"parents"`
+	Data    []byte   `json:"payload"`
+	Meta    Meta     `json:"meta"`
+}
+
+//Export writes all blocks in topological order as JSON Lines
+func (t *Tangle) Export(w io.Writer) (err error) {
+	tx := t.begin(false)
+	defer t.mustCommit(tx)
+
+	enc := json.NewEncoder(w)
+	for it := t.graph.HeightIter(tx, tx.GetGenesis()); it.Next(); {
+		id := it.Curr()
+		d, _ := tx.GetData(id)
+		m, _ := tx.GetMeta(id)
+		if err = enc.Encode(Block{ID: id, Parents: tx.GetC2p(id), Data: d, Meta: m}); err != nil {
+			return fmt.Errorf("failed to encode block %d: %v", id, err)
+		}
+	}
+
+	return
+}
+
+//Import reads blocks as JSON Lines into the (empty) store and returns the tangle
+//they describe. Blocks must be in topological order and keep their ids, blocks
+//without parents become the genesis blocks. The blocks don't describe the
+//options the tangle was created with so these must be provided. It returns
+//ErrTangleExists if the store already holds a tangle. Nothing is written unless
+//all blocks were imported.
+func Import(store Store, r io.Reader, opts ...Option) (t *Tangle, err error) {
+	cfg := newConfig(opts)
+	t = newTangle(store, cfg.Seed)
+
+	tx := t.begin(true)
+	if err = t.importBlocks(tx, r, cfg); err != nil {
+		tx.Discard()
+		return nil, err
+	}
+
+	t.onCommit(tx)
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit: %v", err)
+	}
+
+	return t, nil
+}
+
+//importBlocks writes the config and the blocks read from 'r' in 'tx'
+func (t *Tangle) importBlocks(tx StoreTx, r io.Reader, cfg Config) (err error) {
+	if _, ok := tx.GetConfig(); ok {
+		return ErrTangleExists
+	}
+
+	tx.SetConfig(cfg)
+
+	var genesis []uint64
+	var batch []Block
+	dec := json.NewDecoder(r)
+	for {
+		var b Block
+		if err = dec.Decode(&b); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to decode block: %v", err)
+		}
+
+		if len(b.Parents) == 0 {
+			genesis = append(genesis, b.ID)
+		}
+
+		if batch = append(batch, b); len(batch) >= batchWindow {
+			if err = t.receiveBlocks(tx, nil, batch); err != nil {
+				return err
+			}
+
+			batch = batch[:0]
+		}
+	}
+
+	if err = t.receiveBlocks(tx, nil, batch); err != nil {
+		return err
+	}
+
+	tx.SetGenesis(genesis)
+	return nil
+}
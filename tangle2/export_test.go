@@ -0,0 +1,67 @@
+package tangle_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/store"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestExportImport(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	id3 := receive(t, tngl, []byte{0x03}, 1, 2)
+	id4 := receive(t, tngl, []byte{0x04}, 1, id3)
+	receive(t, tngl, []byte{0x05}, id4)
+	id6 := receive(t, tngl, []byte{0x06}, id3, 2)
+
+	buf := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.Export(buf))
+	exp := buf.String()
+	test.Equals(t, 6, strings.Count(exp, "\n"))
+	test.Equals(t, `{"id":1,"parents":null,"payload":"AQ==","meta":{"weight":4,"height":0}}`, strings.Split(exp, "\n")[0])
+
+	t.Run("round trip", func(t *testing.T) {
+		tngl2, err := tangle.Import(store.NewSimple(), strings.NewReader(exp))
+		test.Ok(t, err)
+		test.Equals(t, []uint64{1, 2}, tngl2.Genesis())
+
+		buf := bytes.NewBuffer(nil)
+		test.Ok(t, tngl2.Export(buf))
+		test.Equals(t, exp, buf.String())
+		test.Equals(t, uint64(7), receive(t, tngl2, []byte{0x07}, id4))
+	})
+
+	t.Run("round trip after snapshot", func(t *testing.T) {
+		_, err := tngl.Snapshot(2)
+		test.Ok(t, err)
+
+		buf := bytes.NewBuffer(nil)
+		test.Ok(t, tngl.Export(buf))
+		exp := buf.String()
+
+		tngl2, err := tangle.Import(store.NewSimple(), strings.NewReader(exp))
+		test.Ok(t, err)
+		test.Equals(t, []uint64{id4, id6}, tngl2.Genesis())
+
+		buf = bytes.NewBuffer(nil)
+		test.Ok(t, tngl2.Export(buf))
+		test.Equals(t, exp, buf.String())
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		lines := strings.SplitAfter(exp, "\n")
+		s := store.NewSimple()
+		_, err := tangle.Import(s, strings.NewReader(lines[0]+lines[1]+lines[2]+"{\n"))
+		test.Equals(t, true, err != nil)
+		checkEmpty(t, s)
+	})
+
+	t.Run("unknown parent", func(t *testing.T) {
+		_, err := tangle.Import(store.NewSimple(), strings.NewReader(`{"id":2,"parents":[1]}`))
+		test.Equals(t, "block 2 references unknown parent 1", err.Error())
+	})
+}
@@ -0,0 +1,199 @@
+package tangle
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+//WriteGraphML writes the tangle as GraphML with weight, height and tip attributes
+func (t *Tangle) WriteGraphML(w io.Writer) (err error) {
+	type key struct {
+		ID   string `xml:"id,attr"`
+		For  string `xml:"for,attr"`
+		Name string `xml:"attr.name,attr"`
+		Type string `xml:"attr.type,attr"`
+	}
+
+	type data struct {
+		Key   string `xml:"key,attr"`
+		Value string `xml:",chardata"`
+	}
+
+	type node struct {
+		ID   string `xml:"id,attr"`
+		Data []data `xml:"data"`
+	}
+
+	type edge struct {
+		Source string `xml:"source,attr"`
+		Target string `xml:"target,attr"`
+	}
+
+	type graphml struct {
+		XMLName xml.Name `xml:"graphml"`
+		NS      string   `xml:"xmlns,attr"`
+		Keys    []key    `xml:"key"`
+		Graph   struct {
+			ID          string `xml:"id,attr"`
+			EdgeDefault string `xml:"edgedefault,attr"`
+			Nodes       []node `xml:"node"`
+			Edges       []edge `xml:"edge"`
+		} `xml:"graph"`
+	}
+
+	nodes, err := t.exportNodes()
+	if err != nil {
+		return err
+	}
+
+	doc := graphml{NS: "http://graphml.graphdrawing.org/xmlns", Keys: []key{
+		{"weight", "node", "weight", "long"},
+		{"height", "node", "height", "long"},
+		{"tip", "node", "tip", "boolean"},
+	}}
+
+	doc.Graph.ID, doc.Graph.EdgeDefault = "tangle", "directed"
+	for _, n := range nodes {
+		id := strconv.FormatUint(n.id, 10)
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node{ID: id, Data: []data{
+			{"weight", strconv.FormatUint(n.meta.Weight, 10)},
+			{"height", strconv.FormatUint(n.meta.Height, 10)},
+			{"tip", strconv.FormatBool(n.tip)},
+		}})
+
+		for _, c := range n.children {
+			doc.Graph.Edges = append(doc.Graph.Edges, edge{id, strconv.FormatUint(c, 10)})
+		}
+	}
+
+	return writeXML(w, doc)
+}
+
+//WriteGEXF writes the tangle as GEXF (as used by Gephi) with weight, height and
+//tip attributes
+func (t *Tangle) WriteGEXF(w io.Writer) (err error) {
+	type attr struct {
+		ID    string `xml:"id,attr"`
+		Title string `xml:"title,attr"`
+		Type  string `xml:"type,attr"`
+	}
+
+	type attvalue struct {
+		For   string `xml:"for,attr"`
+		Value string `xml:"value,attr"`
+	}
+
+	type node struct {
+		ID        string     `xml:"id,attr"`
+		Label     string     `xml:"label,attr"`
+		AttValues []attvalue `xml:"attvalues>attvalue"`
+	}
+
+	type edge struct {
+		ID     int    `xml:"id,attr"`
+		Source string `xml:"source,attr"`
+		Target string `xml:"target,attr"`
+	}
+
+	type gexf struct {
+		XMLName xml.Name `xml:"gexf"`
+		NS      string   `xml:"xmlns,attr"`
+		Version string   `xml:"version,attr"`
+		Graph   struct {
+			DefaultEdgeType string `xml:"defaultedgetype,attr"`
+			Attributes      struct {
+				Class string `xml:"class,attr"`
+				Attrs []attr `xml:"attribute"`
+			} `xml:"attributes"`
+			Nodes []node `xml:"nodes>node"`
+			Edges []edge `xml:"edges>edge"`
+		} `xml:"graph"`
+	}
+
+	nodes, err := t.exportNodes()
+	if err != nil {
+		return err
+	}
+
+	doc := gexf{NS: "http://gexf.net/1.2", Version: "1.2"}
+	doc.Graph.DefaultEdgeType = "directed"
+	doc.Graph.Attributes.Class = "node"
+	doc.Graph.Attributes.Attrs = []attr{{"0", "weight", "long"}, {"1", "height", "long"}, {"2", "tip", "boolean"}}
+	for _, n := range nodes {
+		id := strconv.FormatUint(n.id, 10)
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node{ID: id, Label: id, AttValues: []attvalue{
+			{"0", strconv.FormatUint(n.meta.Weight, 10)},
+			{"1", strconv.FormatUint(n.meta.Height, 10)},
+			{"2", strconv.FormatBool(n.tip)},
+		}})
+
+		for _, c := range n.children {
+			doc.Graph.Edges = append(doc.Graph.Edges, edge{len(doc.Graph.Edges), id, strconv.FormatUint(c, 10)})
+		}
+	}
+
+	return writeXML(w, doc)
+}
+
+//WriteD3 writes the tangle as JSON in the nodes/links shape of a D3 force graph
+func (t *Tangle) WriteD3(w io.Writer) (err error) {
+	type node struct {
+		ID     uint64 `json:"id"`
+		Weight uint64 `json:"weight"`
+		Height uint64 `json:"height"`
+		Tip    bool   `json:"tip"`
+	}
+
+	type link struct {
+		Source uint64 `json:"source"`
+		Target uint64 `json:"target"`
+	}
+
+	nodes, err := t.exportNodes()
+	if err != nil {
+		return err
+	}
+
+	doc := struct {
+		Nodes []node `json:"nodes"`
+		Links []link `json:"links"`
+	}{Nodes: []node{}, Links: []link{}}
+
+	for _, n := range nodes {
+		doc.Nodes = append(doc.Nodes, node{n.id, n.meta.Weight, n.meta.Height, n.tip})
+		for _, c := range n.children {
+			doc.Links = append(doc.Links, link{n.id, c})
+		}
+	}
+
+	if err = json.NewEncoder(w).Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode json: %v", err)
+	}
+
+	return
+}
+
+//exportNodes returns all blocks as they are drawn
+func (t *Tangle) exportNodes() (nodes []drawNode, err error) {
+	tx := t.begin(false)
+	defer t.mustCommit(tx)
+	return t.drawNodes(tx, DrawOptions{})
+}
+
+func writeXML(w io.Writer, doc interface{}) (err error) {
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("failed to write xml header: %v", err)
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err = enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode xml: %v", err)
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return
+}
@@ -0,0 +1,97 @@
+package tangle_test
+
+import (
+	"bytes"
+	"testing"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/store"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestExportFormats(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	receive(t, tngl, []byte{0x03}, 1, 2)
+
+	t.Run("graphml", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		test.Ok(t, tngl.WriteGraphML(buf))
+		test.Equals(t, `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="weight" for="node" attr.name="weight" attr.type="long"></key>
+  <key id="height" for="node" attr.name="height" attr.type="long"></key>
+  <key id="tip" for="node" attr.name="tip" attr.type="boolean"></key>
+  <graph id="tangle" edgedefault="directed">
+    <node id="1">
+      <data key="weight">1</data>
+      <data key="height">0</data>
+      <data key="tip">false</data>
+    </node>
+    <node id="2">
+      <data key="weight">1</data>
+      <data key="height">0</data>
+      <data key="tip">false</data>
+    </node>
+    <node id="3">
+      <data key="weight">0</data>
+      <data key="height">1</data>
+      <data key="tip">true</data>
+    </node>
+    <edge source="1" target="3"></edge>
+    <edge source="2" target="3"></edge>
+  </graph>
+</graphml>
+`, buf.String())
+	})
+
+	t.Run("gexf", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		test.Ok(t, tngl.WriteGEXF(buf))
+		test.Equals(t, `<?xml version="1.0" encoding="UTF-8"?>
+<gexf xmlns="http://gexf.net/1.2" version="1.2">
+  <graph defaultedgetype="directed">
+    <attributes class="node">
+      <attribute id="0" title="weight" type="long"></attribute>
+      <attribute id="1" title="height" type="long"></attribute>
+      <attribute id="2" title="tip" type="boolean"></attribute>
+    </attributes>
+    <nodes>
+      <node id="1" label="1">
+        <attvalues>
+          <attvalue for="0" value="1"></attvalue>
+          <attvalue for="1" value="0"></attvalue>
+          <attvalue for="2" value="false"></attvalue>
+        </attvalues>
+      </node>
+      <node id="2" label="2">
+        <attvalues>
+          <attvalue for="0" value="1"></attvalue>
+          <attvalue for="1" value="0"></attvalue>
+          <attvalue for="2" value="false"></attvalue>
+        </attvalues>
+      </node>
+      <node id="3" label="3">
+        <attvalues>
+          <attvalue for="0" value="0"></attvalue>
+          <attvalue for="1" value="1"></attvalue>
+          <attvalue for="2" value="true"></attvalue>
+        </attvalues>
+      </node>
+    </nodes>
+    <edges>
+      <edge id="0" source="1" target="3"></edge>
+      <edge id="1" source="2" target="3"></edge>
+    </edges>
+  </graph>
+</gexf>
+`, buf.String())
+	})
+
+	t.Run("d3", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		test.Ok(t, tngl.WriteD3(buf))
+		test.Equals(t, `{"nodes":[{"id":1,"weight":1,"height":0,"tip":false},{"id":2,"weight":1,"height":0,"tip":false},{"id":3,"weight":0,"height":1,"tip":true}],"links":[{"source":1,"target":3},{"source":2,"target":3}]}
+`, buf.String())
+	})
+}
@@ -1,7 +1,9 @@
 package tangle
 
 import (
+	"context"
 	"errors"
+	"math"
 	"math/rand"
 	"sort"
 	"sync"
@@ -10,6 +12,18 @@ import (
 var (
 	//ErrSkipNext can returned to stop the walk
 	ErrSkipNext = errors.New("skip next")
+
+	//ErrStopWalk can be returned to end the walk without an error
+	ErrStopWalk = errors.New("stop walk")
+
+	//ErrBlockExists is returned when appending a block that already exists
+	ErrBlockExists = errors.New("block already exists")
+
+	//ErrParentNotExist is returned when appending a block with an unknown parent
+	ErrParentNotExist = errors.New("parent doesn't exist")
+
+	//ErrBlockNotExist is returned when a requested block doesn't exist
+	ErrBlockNotExist = errors.New("block doesn't exist")
 )
 
 //Weight returns the weight of the provided block, if the provided block does'nt exist it panics
@@ -31,97 +45,377 @@ func (g *Graph) Tips(tx StoreTx) (tips []uint64) {
 	return
 }
 
-//Append a new block to the DAG
-func (g *Graph) Append(tx StoreTx, id uint64, data []byte, parents ...uint64) {
-	_, ok := tx.GetData(id)
-	if ok {
-		panic("block already exists")
+//Append a new block to the DAG, the graph is not modified if an error is returned
+func (g *Graph) Append(tx StoreTx, id uint64, data []byte, parents ...uint64) (err error) {
+	return g.append(context.Background(), tx, nil, id, data, parents...)
+}
+
+//append a new block and call 'emit' (if not nil) for every change it causes.
+//If the context is done while weights are updated its error is returned and
+//the transaction holds a partial update, it must then be discarded.
+func (g *Graph) append(ctx context.Context, tx StoreTx, emit func(Event), id uint64, data []byte, parents ...uint64) (err error) {
+	if emit == nil {
+		emit = func(Event) {}
 	}
 
-	//set data and make new tips
-	tx.SetData(id, data)
-	tx.SetTip(id)
+	if _, ok := tx.GetMeta(id); ok {
+		return ErrBlockExists
+	}
 
-	//update edges and tipsier
+	//adjust new block height to be max of parent height
 	var height uint64
 	for _, pid := range parents {
 		pmeta, ok := tx.GetMeta(pid)
 		if !ok {
-			panic("parent (meta) doesn't exist")
+			return ErrParentNotExist
 		}
 
-		//adjust new block height to be max of parent height
-		nheight := pmeta.Height + 1
-		if nheight > height {
+		if nheight := pmeta.Height + 1; nheight > height {
 			height = nheight
 		}
+	}
 
+	//set data, meta and make new tips
+	m := Meta{Height: height}
+	tx.SetData(id, data)
+	tx.SetMeta(id, m)
+	tx.SetTip(id)
+	emit(Event{Type: BlockAttached, ID: id, Meta: m})
+	emit(Event{Type: TipAdded, ID: id, Meta: m})
+
+	//update edges and tipsier
+	tips := tx.GetTips()
+	for _, pid := range parents {
 		//if parent was part of tips, it is no longer
-		if _, ok := tx.GetTips()[pid]; ok {
+		if _, ok := tips[pid]; ok {
+			delete(tips, pid)
 			tx.DelTip(pid)
+			pmeta, _ := tx.GetMeta(pid)
+			emit(Event{Type: TipRemoved, ID: pid, Meta: pmeta})
 		}
 
 		//update edges
 		tx.SetP2c(pid, append(tx.GetP2c(pid), id))
-		tx.SetC2p(id, append(tx.GetC2p(id), pid))
+	}
+
+	if len(parents) > 0 {
+		tx.SetC2p(id, parents)
 	}
 
 	//update weights for each block (in)directly referenced
-	if err := g.Walk(tx, parents, g.Parents, false, func(id uint64, data []byte, m Meta, la []uint64) error {
+	return g.WalkContext(ctx, tx, parents, g.Parents, false, func(id uint64, m Meta, la []uint64) error {
 		m.Weight++
 		tx.SetMeta(id, m)
+		emit(Event{Type: WeightChanged, ID: id, Meta: m, prev: m.Weight - 1})
 		return nil
-	}); err != nil {
-		panic("failed to update weights: " + err.Error())
-	}
-
-	//set this blocks meta
-	tx.SetMeta(id, Meta{Height: height})
+	})
 }
 
-type nextFunc func(tx StoreTx, id uint64) []uint64                    //determine the next nodes
-type walkFunc func(id uint64, data []byte, m Meta, la []uint64) error //execute for each node
+type nextFunc func(tx StoreTx, id uint64) []uint64       //determine the next nodes
+type walkFunc func(id uint64, m Meta, la []uint64) error //execute for each node
 
 //Walk the graph
 func (g *Graph) Walk(tx StoreTx, f []uint64, nf nextFunc, depthFirst bool, wf walkFunc) (err error) {
+	return g.WalkContext(context.Background(), tx, f, nf, depthFirst, wf)
+}
+
+//WalkContext walks the graph like Walk but stops before visiting the next
+//block once the context is done, it then returns the context's error
+func (g *Graph) WalkContext(ctx context.Context, tx StoreTx, f []uint64, nf nextFunc, depthFirst bool, wf walkFunc) (err error) {
+	return g.WalkWith(ctx, tx, f, nf, WalkOptions{DepthFirst: depthFirst}, wf)
+}
+
+//WalkOptions bound the work done by a walk
+type WalkOptions struct {
+	DepthFirst bool                 //prepend the lookahead instead of appending it
+	MaxDepth   int                  //don't follow blocks further than this from 'f', zero is unlimited
+	MaxVisits  int                  //stop after visiting this many blocks, zero is unlimited
+	Filter     func(id uint64) bool //only look ahead to blocks for which this returns true
+	Priority   KeyFunc              //visit the block with the lowest key first, overrides DepthFirst
+}
+
+//KeyFunc returns the key a block is ordered by in a priority walk
+type KeyFunc func(id uint64, m Meta) uint64
+
+//ByHeight orders a priority walk by height, lowest first
+func ByHeight(id uint64, m Meta) uint64 { return m.Height }
+
+//ByWeight orders a priority walk by weight, heaviest first
+func ByWeight(id uint64, m Meta) uint64 { return math.MaxUint64 - m.Weight }
+
+//WalkWith walks the graph from 'f' as bounded by the options. The walk ends
+//without error when 'wf' returns ErrStopWalk or the visit budget is spent.
+//The depth of a block is the number of edges it was first reached by, which is
+//only the shortest distance to 'f' for breadth-first walks.
+func (g *Graph) WalkWith(ctx context.Context, tx StoreTx, f []uint64, nf nextFunc, o WalkOptions, wf walkFunc) (err error) {
 	visited := make(map[uint64]struct{})
-	frontier := NewIter(f...)
+	depth := make(map[uint64]int, len(f))
+	for _, id := range f {
+		depth[id] = 0
+	}
+
+	var frontier interface {
+		Next() bool
+		Curr() uint64
+	}
+
+	var push func(id uint64)
+	if o.Priority != nil {
+		pi := NewPrioIter()
+		push = func(id uint64) {
+			m, _ := tx.GetMeta(id)
+			pi.Push(id, o.Priority(id, m))
+		}
+
+		for _, id := range f {
+			push(id)
+		}
 
+		frontier = pi
+	} else {
+		it := NewIter(f...)
+		push = func(id uint64) { it.Append(id) }
+		if o.DepthFirst {
+			push = func(id uint64) { it.Prepend(id) }
+		}
+
+		frontier = it
+	}
+
+	defer func() { g.metrics.observeWalk(len(visited)) }()
+
+	var visits int
 	for frontier.Next() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
 		bid := frontier.Curr()
 		if _, ok := visited[bid]; ok {
 			continue
 		}
 
-		b, _ := tx.GetData(bid)
-		if b == nil {
+		if o.MaxVisits > 0 && visits >= o.MaxVisits {
+			return nil
+		}
+
+		m, ok := tx.GetMeta(bid) //current blocks's meta, payloads are not loaded
+		if !ok {
 			panic("block doesn't exist")
 		}
 
-		m, _ := tx.GetMeta(bid)  //current blocks's meta
 		lookahead := nf(tx, bid) //curernt block's lookahead
+		if o.Filter != nil {
+			var filtered []uint64
+			for _, n := range lookahead {
+				if o.Filter(n) {
+					filtered = append(filtered, n)
+				}
+			}
+
+			lookahead = filtered
+		}
 
-		err = wf(bid, b, m, lookahead)
+		visits++
+		err = wf(bid, m, lookahead)
 		if err == ErrSkipNext {
 			err = nil
 			continue
+		} else if err == ErrStopWalk {
+			return nil
 		} else if err != nil {
 			return err //return user error unmodified
 		}
 
 		visited[bid] = struct{}{}
+		d := depth[bid] + 1
+		if o.MaxDepth > 0 && d > o.MaxDepth {
+			continue
+		}
+
 		for _, n := range lookahead {
-			if depthFirst {
-				frontier.Prepend(n)
-			} else {
-				frontier.Append(n)
+			if prev, ok := depth[n]; !ok || d < prev {
+				depth[n] = d
 			}
+
+			push(n)
 		}
 	}
 
 	return
 }
 
+//Topo walks all blocks that can be reached from 'f' through their children in
+//topological order (Kahn's algorithm), a block is visited only after all of its
+//reachable parents are. Returning ErrSkipNext from 'wf' means none of the
+//blocks that (in)directly depend on that block will be visited, returning
+//ErrStopWalk ends the walk without an error.
+func (g *Graph) Topo(tx StoreTx, f []uint64, wf walkFunc) (err error) {
+	indeg := make(map[uint64]int) //number of reachable parents not yet visited
+	if err = g.Walk(tx, f, g.Children, false, func(id uint64, m Meta, la []uint64) error {
+		if _, ok := indeg[id]; !ok {
+			indeg[id] = 0
+		}
+
+		for _, cid := range la {
+			indeg[cid]++
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	frontier := NewIter()
+	for _, id := range f {
+		if indeg[id] == 0 {
+			frontier.Append(id)
+			indeg[id] = -1 //queue only once
+		}
+	}
+
+	for frontier.Next() {
+		id := frontier.Curr()
+		m, _ := tx.GetMeta(id)
+		children := g.Children(tx, id)
+
+		err = wf(id, m, children)
+		if err == ErrSkipNext {
+			err = nil
+			continue
+		} else if err == ErrStopWalk {
+			return nil
+		} else if err != nil {
+			return err //return user error unmodified
+		}
+
+		for _, cid := range children {
+			indeg[cid]--
+			if indeg[cid] == 0 {
+				frontier.Append(cid)
+			}
+		}
+	}
+
+	return
+}
+
+//Prune deletes all blocks below 'height' that can be reached from 'f'. It returns
+//the remaining blocks that are left without parents, these are the solid entry
+//points from which the rest of the graph can be walked. If no block would be
+//left the graph is not modified and nil is returned.
+func (g *Graph) Prune(tx StoreTx, f []uint64, height uint64) (entries []uint64) {
+	//blocks are reached by height, so the ones that are left come last
+	var cut []uint64
+	for it := g.HeightIter(tx, f); it.Next(); {
+		if m, _ := tx.GetMeta(it.Curr()); m.Height >= height {
+			cut = append(cut, it.Curr())
+			it.Skip()
+		}
+	}
+
+	if len(cut) == 0 {
+		return nil
+	}
+
+	//delete each block after advancing past it, which queues its children
+	var prev uint64
+	var del bool
+	for it := g.HeightIter(tx, f); it.Next(); {
+		if del {
+			g.delete(tx, prev)
+		}
+
+		prev = it.Curr()
+		if m, _ := tx.GetMeta(prev); m.Height >= height {
+			del = false
+			it.Skip()
+			continue
+		}
+
+		del = true
+	}
+
+	if del {
+		g.delete(tx, prev)
+	}
+
+	return g.detach(tx, cut)
+}
+
+//PruneCone deletes the past cone of block 'id': all blocks it (in)directly
+//approves. It returns the remaining blocks that are left without parents, which
+//includes 'id', these are the solid entry points from which the rest of the
+//graph can be walked. Blocks that are not in the cone, nor approve it, are left
+//alone. If 'id' has no parents the graph is not modified and nil is returned.
+func (g *Graph) PruneCone(tx StoreTx, id uint64) (entries []uint64) {
+	cone := make(map[uint64]struct{})
+	if err := g.Walk(tx, g.Parents(tx, id), g.Parents, false, func(pid uint64, m Meta, la []uint64) error {
+		cone[pid] = struct{}{}
+		return nil
+	}); err != nil {
+		panic("failed to walk for pruning: " + err.Error())
+	}
+
+	if len(cone) == 0 {
+		return nil
+	}
+
+	//children outside of the cone keep what is left of their parents
+	edge := make(map[uint64]struct{})
+	for pid := range cone {
+		for _, cid := range g.Children(tx, pid) {
+			if _, ok := cone[cid]; !ok {
+				edge[cid] = struct{}{}
+			}
+		}
+	}
+
+	for pid := range cone {
+		g.delete(tx, pid)
+	}
+
+	left := make([]uint64, 0, len(edge))
+	for cid := range edge {
+		left = append(left, cid)
+	}
+
+	return g.detach(tx, left)
+}
+
+//detach removes the edges from 'ids' towards deleted parents, the blocks that
+//are left without any parents become entry points and are returned in order
+func (g *Graph) detach(tx StoreTx, ids []uint64) (entries []uint64) {
+	for _, id := range ids {
+		var parents []uint64
+		for _, pid := range tx.GetC2p(id) {
+			if _, ok := tx.GetMeta(pid); ok {
+				parents = append(parents, pid)
+			}
+		}
+
+		if len(parents) > 0 {
+			tx.SetC2p(id, parents)
+			continue
+		}
+
+		tx.DelC2p(id)
+		entries = append(entries, id)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i] < entries[j] })
+	return
+}
+
+//delete removes all of a block from the store
+func (g *Graph) delete(tx StoreTx, id uint64) {
+	tx.DelData(id)
+	tx.DelMeta(id)
+	tx.DelP2c(id)
+	tx.DelC2p(id)
+	tx.DelTip(id)
+}
+
 //Parents returns the parents of a given block
 func (g *Graph) Parents(tx StoreTx, id uint64) (parents []uint64) {
 	parents = tx.GetC2p(id)
@@ -171,6 +465,68 @@ func (g *Graph) ChildrenWRS(tx StoreTx, id uint64) (children []uint64) {
 	return sh
 }
 
+//HeightIter returns an iterator over all blocks that can be reached from 'f'
+//ordered by height and id. Children are always higher then their parents so the
+//order is topological. Blocks are walked as the iterator advances, only the
+//frontier of the walk is kept in memory.
+func (g *Graph) HeightIter(tx StoreTx, f []uint64) (it *TopoIter) {
+	it = &TopoIter{g: g, tx: tx, pi: NewPrioIter()}
+	for _, id := range f {
+		it.push(id)
+	}
+
+	return
+}
+
+//TopoIter iterates blocks by height while walking their children, see
+//HeightIter
+type TopoIter struct {
+	g    *Graph
+	tx   StoreTx
+	pi   *PrioIter
+	c    uint64
+	curr bool //if 'c' was returned, its children are queued on the next call
+	skip bool
+}
+
+func (it *TopoIter) push(id uint64) {
+	m, _ := it.tx.GetMeta(id)
+	it.pi.Push(id, m.Height)
+}
+
+//Skip the children of the current block, they are still returned if they
+//can be reached through other blocks
+func (it *TopoIter) Skip() {
+	it.skip = true
+}
+
+//Next advances the iterator, returns false when done
+func (it *TopoIter) Next() bool {
+	if it.curr && !it.skip {
+		for _, cid := range it.g.Children(it.tx, it.c) {
+			it.push(cid)
+		}
+	}
+
+	it.skip = false
+	for it.pi.Next() {
+		id := it.pi.Curr()
+		if it.curr && id == it.c {
+			continue //queued by more than one parent, equal keys are returned in a row
+		}
+
+		it.c, it.curr = id, true
+		return true
+	}
+
+	return false
+}
+
+//Curr returns the current iter position
+func (it *TopoIter) Curr() uint64 {
+	return it.c
+}
+
 //Get will return a block by its id or return nil if not found
 func (g *Graph) Get(tx StoreTx, id uint64) (data []byte) {
 	data, _ = tx.GetData(id)
@@ -179,15 +535,16 @@ func (g *Graph) Get(tx StoreTx, id uint64) (data []byte) {
 
 //Meta information about a block
 type Meta struct {
-	Weight uint64
-	Height uint64
+	Weight uint64 `json:"weight"`
+	Height uint64 `json:"height"`
 }
 
 //Graph stores blocks
 type Graph struct {
-	seed int64
-	rnd  *rand.Rand
-	rmu  sync.Mutex
+	seed    int64
+	rnd     *rand.Rand
+	rmu     sync.Mutex
+	metrics *Metrics
 }
 
 //NewGraph initates a store
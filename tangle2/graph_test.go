@@ -1,6 +1,7 @@
 package tangle_test
 
 import (
+	"context"
 	"errors"
 	"math"
 	"sync"
@@ -38,7 +39,7 @@ func TestRandomWalk(t *testing.T) {
 		distFirstSplit := map[uint64]int{}
 		for i := 0; i < 10; i++ {
 			rw := []uint64{}
-			test.Ok(t, g.Walk(tx, []uint64{0}, g.RevChildrenWRS, true, func(bid uint64, d []byte, m tangle.Meta, la []uint64) (err error) {
+			test.Ok(t, g.Walk(tx, []uint64{0}, g.RevChildrenWRS, true, func(bid uint64, m tangle.Meta, la []uint64) (err error) {
 				rw = append(rw, bid)
 				return
 			}))
@@ -124,7 +125,7 @@ func TestStoreLinearBlocks(t *testing.T) {
 
 		var visited []uint64
 		var height uint64
-		test.Ok(t, g.Walk(tx, []uint64{0}, g.Children, false, func(bid uint64, d []byte, m tangle.Meta, la []uint64) (err error) {
+		test.Ok(t, g.Walk(tx, []uint64{0}, g.Children, false, func(bid uint64, m tangle.Meta, la []uint64) (err error) {
 			if bid == 0 {
 				test.Equals(t, uint64(99), m.Weight)
 			}
@@ -139,6 +140,302 @@ func TestStoreLinearBlocks(t *testing.T) {
 	})
 }
 
+func TestTopologicalOrder(t *testing.T) {
+	s := store.NewSimple()
+	g := tangle.NewGraph(42)
+	tx := s.NewTransaction(true)
+	defer checkCommit(t, tx)
+
+	g.Append(tx, 0, []byte{})
+	/**/ g.Append(tx, 1, []byte{0x0A}, 0)
+	/**/ g.Append(tx, 2, []byte{0x0B}, 0)
+	/*  */ g.Append(tx, 3, []byte{0x1A}, 2)
+	/*    */ g.Append(tx, 4, []byte{0x2A}, 1, 3)
+
+	collect := func(ids *[]uint64) func(bid uint64, m tangle.Meta, la []uint64) error {
+		return func(bid uint64, m tangle.Meta, la []uint64) (err error) {
+			*ids = append(*ids, bid)
+			return
+		}
+	}
+
+	t.Run("breadth-first is not topological", func(t *testing.T) {
+		var bfs []uint64
+		test.Ok(t, g.Walk(tx, []uint64{0}, g.Children, false, collect(&bfs)))
+		test.Equals(t, []uint64{0, 1, 2, 4, 3}, bfs)
+	})
+
+	t.Run("topo", func(t *testing.T) {
+		var topo []uint64
+		test.Ok(t, g.Topo(tx, []uint64{0}, collect(&topo)))
+		test.Equals(t, []uint64{0, 1, 2, 3, 4}, topo)
+	})
+
+	t.Run("topo from multiple blocks", func(t *testing.T) {
+		var topo []uint64
+		test.Ok(t, g.Topo(tx, []uint64{3, 1, 3}, collect(&topo)))
+		test.Equals(t, []uint64{3, 1, 4}, topo)
+	})
+
+	t.Run("topo skip", func(t *testing.T) {
+		var topo []uint64
+		test.Ok(t, g.Topo(tx, []uint64{0}, func(bid uint64, m tangle.Meta, la []uint64) (err error) {
+			topo = append(topo, bid)
+			if bid == 3 {
+				return tangle.ErrSkipNext
+			}
+
+			return
+		}))
+
+		test.Equals(t, []uint64{0, 1, 2, 3}, topo)
+	})
+
+	t.Run("topo stop", func(t *testing.T) {
+		var topo []uint64
+		test.Ok(t, g.Topo(tx, []uint64{0}, func(bid uint64, m tangle.Meta, la []uint64) (err error) {
+			topo = append(topo, bid)
+			if bid == 2 {
+				return tangle.ErrStopWalk
+			}
+
+			return
+		}))
+
+		test.Equals(t, []uint64{0, 1, 2}, topo)
+	})
+
+	t.Run("by height", func(t *testing.T) {
+		var ids []uint64
+		for it := g.HeightIter(tx, []uint64{0}); it.Next(); {
+			ids = append(ids, it.Curr())
+		}
+
+		test.Equals(t, []uint64{0, 1, 2, 3, 4}, ids)
+	})
+
+	t.Run("by height from multiple blocks", func(t *testing.T) {
+		var ids []uint64
+		for it := g.HeightIter(tx, []uint64{3, 1, 3}); it.Next(); {
+			ids = append(ids, it.Curr())
+		}
+
+		test.Equals(t, []uint64{1, 3, 4}, ids)
+	})
+
+	t.Run("by height skip", func(t *testing.T) {
+		var ids []uint64
+		for it := g.HeightIter(tx, []uint64{0}); it.Next(); {
+			if ids = append(ids, it.Curr()); it.Curr() == 2 {
+				it.Skip() //3 is only reached through 2
+			}
+		}
+
+		test.Equals(t, []uint64{0, 1, 2, 4}, ids)
+	})
+}
+
+func TestPrune(t *testing.T) {
+	s := store.NewSimple()
+	g := tangle.NewGraph(42)
+	tx := s.NewTransaction(true)
+	defer checkCommit(t, tx)
+
+	g.Append(tx, 0, []byte{})
+	/**/ g.Append(tx, 1, []byte{0x0A}, 0)
+	/**/ g.Append(tx, 2, []byte{0x0B}, 0)
+	/*  */ g.Append(tx, 3, []byte{0x1A}, 1, 2)
+	/*    */ g.Append(tx, 4, []byte{0x2A}, 3)
+	/*    */ g.Append(tx, 5, []byte{0x2B}, 3, 1)
+
+	t.Run("cut above all blocks", func(t *testing.T) {
+		test.Equals(t, []uint64(nil), g.Prune(tx, []uint64{0}, 100))
+		test.Equals(t, []byte{}, g.Get(tx, 0)) //nothing was pruned
+	})
+
+	t.Run("cut at height 2", func(t *testing.T) {
+		test.Equals(t, []uint64{3}, g.Prune(tx, []uint64{0}, 2))
+		for _, id := range []uint64{0, 1, 2} {
+			test.Equals(t, []byte(nil), g.Get(tx, id))
+			test.Equals(t, []uint64(nil), g.Children(tx, id))
+		}
+
+		test.Equals(t, []uint64(nil), g.Parents(tx, 3))
+		test.Equals(t, []uint64{3}, g.Parents(tx, 5))
+		test.Equals(t, uint64(2), g.Weight(tx, 3))
+
+		var visited []uint64
+		test.Ok(t, g.Walk(tx, []uint64{3}, g.Children, false, func(bid uint64, m tangle.Meta, la []uint64) (err error) {
+			visited = append(visited, bid)
+			return
+		}))
+
+		test.Equals(t, []uint64{3, 4, 5}, visited)
+	})
+}
+
+func TestPruneCone(t *testing.T) {
+	build := func() (tangle.StoreTx, *tangle.Graph) {
+		g := tangle.NewGraph(42)
+		tx := store.NewSimple().NewTransaction(true)
+		g.Append(tx, 0, []byte{})
+		/**/ g.Append(tx, 1, []byte{0x0A}, 0)
+		/**/ g.Append(tx, 2, []byte{0x0B}, 0)
+		/*  */ g.Append(tx, 3, []byte{0x1A}, 1, 2)
+		/*    */ g.Append(tx, 4, []byte{0x2A}, 3)
+		/*    */ g.Append(tx, 5, []byte{0x2B}, 3, 1)
+		return tx, g
+	}
+
+	t.Run("without parents", func(t *testing.T) {
+		tx, g := build()
+		defer checkCommit(t, tx)
+		test.Equals(t, []uint64(nil), g.PruneCone(tx, 0))
+		test.Equals(t, []uint64{1, 2}, g.Children(tx, 0))
+	})
+
+	t.Run("cone of 3", func(t *testing.T) {
+		tx, g := build()
+		defer checkCommit(t, tx)
+		test.Equals(t, []uint64{3}, g.PruneCone(tx, 3))
+		for _, id := range []uint64{0, 1, 2} {
+			test.Equals(t, []byte(nil), g.Get(tx, id))
+		}
+
+		test.Equals(t, []uint64(nil), g.Parents(tx, 3))
+		test.Equals(t, []uint64{3}, g.Parents(tx, 5)) //keeps the parent that is left
+	})
+
+	t.Run("cone of 4", func(t *testing.T) {
+		tx, g := build()
+		defer checkCommit(t, tx)
+		test.Equals(t, []uint64{4, 5}, g.PruneCone(tx, 4)) //5 lost all of its parents
+		test.Equals(t, []byte(nil), g.Get(tx, 3))
+		test.Equals(t, []byte{0x2B}, g.Get(tx, 5))
+	})
+}
+
+func TestWalkContext(t *testing.T) {
+	s := store.NewSimple()
+	g := tangle.NewGraph(42)
+	tx := s.NewTransaction(true)
+	defer checkCommit(t, tx)
+
+	g.Append(tx, 0, []byte{})
+	/**/ g.Append(tx, 1, []byte{}, 0)
+	/*  */ g.Append(tx, 2, []byte{}, 1)
+	/*    */ g.Append(tx, 3, []byte{}, 2)
+
+	t.Run("done before the walk", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var visited []uint64
+		err := g.WalkContext(ctx, tx, []uint64{0}, g.Children, false, func(bid uint64, m tangle.Meta, la []uint64) (err error) {
+			visited = append(visited, bid)
+			return
+		})
+
+		test.Equals(t, context.Canceled, err)
+		test.Equals(t, []uint64(nil), visited)
+	})
+
+	t.Run("done during the walk", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var visited []uint64
+		err := g.WalkContext(ctx, tx, []uint64{0}, g.Children, false, func(bid uint64, m tangle.Meta, la []uint64) (err error) {
+			visited = append(visited, bid)
+			if bid == 1 {
+				cancel()
+			}
+
+			return
+		})
+
+		test.Equals(t, context.Canceled, err)
+		test.Equals(t, []uint64{0, 1}, visited)
+	})
+}
+
+func TestWalkOptions(t *testing.T) {
+	s := store.NewSimple()
+	g := tangle.NewGraph(42)
+	tx := s.NewTransaction(true)
+	defer checkCommit(t, tx)
+
+	g.Append(tx, 0, []byte{})
+	/**/ g.Append(tx, 1, []byte{}, 0)
+	/**/ g.Append(tx, 2, []byte{}, 0)
+	/*  */ g.Append(tx, 3, []byte{}, 1, 2)
+	/*    */ g.Append(tx, 4, []byte{}, 3)
+
+	walk := func(o tangle.WalkOptions, stopAt uint64) (visited []uint64) {
+		test.Ok(t, g.WalkWith(context.Background(), tx, []uint64{0}, g.Children, o, func(bid uint64, m tangle.Meta, la []uint64) (err error) {
+			visited = append(visited, bid)
+			if bid == stopAt {
+				return tangle.ErrStopWalk
+			}
+
+			return
+		}))
+
+		return
+	}
+
+	for _, c := range []struct {
+		name   string
+		o      tangle.WalkOptions
+		stopAt uint64
+		exp    []uint64
+	}{
+		{"unbounded", tangle.WalkOptions{}, 99, []uint64{0, 1, 2, 3, 4}},
+		{"stop walk", tangle.WalkOptions{}, 2, []uint64{0, 1, 2}},
+		{"max depth", tangle.WalkOptions{MaxDepth: 2}, 99, []uint64{0, 1, 2, 3}},
+		{"max visits", tangle.WalkOptions{MaxVisits: 4}, 99, []uint64{0, 1, 2, 3}},
+		{"filter", tangle.WalkOptions{Filter: func(id uint64) bool { return id != 1 }}, 99, []uint64{0, 2, 3, 4}},
+		{"depth first", tangle.WalkOptions{DepthFirst: true, MaxDepth: 1}, 99, []uint64{0, 2, 1}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			test.Equals(t, c.exp, walk(c.o, c.stopAt))
+		})
+	}
+}
+
+func TestPriorityWalk(t *testing.T) {
+	s := store.NewSimple()
+	g := tangle.NewGraph(42)
+	tx := s.NewTransaction(true)
+	defer checkCommit(t, tx)
+
+	g.Append(tx, 0, []byte{})
+	/**/ g.Append(tx, 1, []byte{}, 0)
+	/**/ g.Append(tx, 2, []byte{}, 0)
+	/*  */ g.Append(tx, 3, []byte{}, 1)
+	/*    */ g.Append(tx, 4, []byte{}, 3)
+
+	for _, c := range []struct {
+		name string
+		key  tangle.KeyFunc
+		exp  []uint64
+	}{
+		{"by height", tangle.ByHeight, []uint64{0, 1, 2, 3, 4}},
+		{"by weight", tangle.ByWeight, []uint64{0, 1, 3, 2, 4}},
+		{"by highest id", func(id uint64, m tangle.Meta) uint64 { return math.MaxUint64 - id }, []uint64{0, 2, 1, 3, 4}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var visited []uint64
+			test.Ok(t, g.WalkWith(context.Background(), tx, []uint64{0}, g.Children, tangle.WalkOptions{Priority: c.key}, func(bid uint64, m tangle.Meta, la []uint64) (err error) {
+				visited = append(visited, bid)
+				return
+			}))
+
+			test.Equals(t, c.exp, visited)
+		})
+	}
+}
+
 func TestStoreFanOutConcurrentBlockPut(t *testing.T) {
 	n := uint64(100) //insert this many blocks
 
@@ -205,7 +502,7 @@ func TestStoreFanOutConcurrentBlockPut(t *testing.T) {
 
 		t.Run("front to back", func(t *testing.T) {
 			var f2b []uint64 //walk front 2 back
-			test.Ok(t, g.Walk(tx, g.Tips(tx), g.Parents, false, func(bid uint64, d []byte, m tangle.Meta, la []uint64) (err error) {
+			test.Ok(t, g.Walk(tx, g.Tips(tx), g.Parents, false, func(bid uint64, m tangle.Meta, la []uint64) (err error) {
 				f2b = append(f2b, bid)
 				return
 			}))
@@ -216,7 +513,7 @@ func TestStoreFanOutConcurrentBlockPut(t *testing.T) {
 
 		t.Run("front to back depth-first", func(t *testing.T) {
 			var f2b []uint64 //walk front 2 back
-			test.Ok(t, g.Walk(tx, g.Tips(tx), g.Parents, true, func(bid uint64, d []byte, m tangle.Meta, la []uint64) (err error) {
+			test.Ok(t, g.Walk(tx, g.Tips(tx), g.Parents, true, func(bid uint64, m tangle.Meta, la []uint64) (err error) {
 				f2b = append(f2b, bid)
 				return
 			}))
@@ -228,7 +525,7 @@ func TestStoreFanOutConcurrentBlockPut(t *testing.T) {
 		t.Run("back to front", func(t *testing.T) {
 			var b2f []uint64 //walk back to front
 			height := uint64(math.MaxUint64)
-			test.Ok(t, g.Walk(tx, []uint64{math.MaxUint64}, g.Children, false, func(bid uint64, d []byte, m tangle.Meta, la []uint64) (err error) {
+			test.Ok(t, g.Walk(tx, []uint64{math.MaxUint64}, g.Children, false, func(bid uint64, m tangle.Meta, la []uint64) (err error) {
 				b2f = append(b2f, bid)
 				height = m.Height
 				return
@@ -243,7 +540,7 @@ func TestStoreFanOutConcurrentBlockPut(t *testing.T) {
 			testErr := errors.New("test error")
 			var errv []uint64 //walk back to front
 			height := uint64(math.MaxUint64)
-			test.Equals(t, testErr, g.Walk(tx, []uint64{math.MaxUint64}, g.Children, false, func(bid uint64, d []byte, m tangle.Meta, la []uint64) (err error) {
+			test.Equals(t, testErr, g.Walk(tx, []uint64{math.MaxUint64}, g.Children, false, func(bid uint64, m tangle.Meta, la []uint64) (err error) {
 				errv = append(errv, bid)
 				height = m.Height
 				return testErr
@@ -1,14 +1,16 @@
 package tangle
 
+import "container/heap"
+
 //Iter is a block id iterator
 type Iter struct {
 	v []uint64
 	c uint64
 }
 
-//NewIter create an id iterator
+//NewIter create an id iterator, it doesn't modify 'ids'
 func NewIter(ids ...uint64) *Iter {
-	return &Iter{v: ids}
+	return &Iter{v: append([]uint64(nil), ids...)}
 }
 
 //Append values, calling next will return these at the end now
@@ -18,7 +20,7 @@ func (i *Iter) Append(v ...uint64) {
 
 //Prepend values, calling next will immediately start returning them
 func (i *Iter) Prepend(v ...uint64) {
-	i.v = append(v, i.v...)
+	i.v = append(append([]uint64(nil), v...), i.v...)
 }
 
 //Next advances the iterator, returns false when done
@@ -36,3 +38,58 @@ func (i *Iter) Curr() (v uint64) {
 
 	return i.c
 }
+
+//PrioIter is a block id iterator that returns the id with the lowest key
+//first, ids with equal keys are returned lowest id first
+type PrioIter struct {
+	h prioHeap
+	c uint64
+}
+
+//NewPrioIter creates an empty priority iterator
+func NewPrioIter() *PrioIter {
+	return &PrioIter{}
+}
+
+//Push an id with the key it is ordered by
+func (i *PrioIter) Push(id, key uint64) {
+	heap.Push(&i.h, prioItem{id: id, key: key})
+}
+
+//Next advances the iterator to the id with the lowest key, returns false when done
+func (i *PrioIter) Next() (b bool) {
+	if len(i.h) == 0 {
+		return false
+	}
+
+	i.c = heap.Pop(&i.h).(prioItem).id
+	return true
+}
+
+//Curr returns the current iter position
+func (i *PrioIter) Curr() (v uint64) {
+	return i.c
+}
+
+type prioItem struct{ id, key uint64 }
+
+//prioHeap implements heap.Interface for the priority iterator
+type prioHeap []prioItem
+
+func (h prioHeap) Len() int      { return len(h) }
+func (h prioHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h prioHeap) Less(i, j int) bool {
+	if h[i].key == h[j].key {
+		return h[i].id < h[j].id
+	}
+
+	return h[i].key < h[j].key
+}
+
+func (h *prioHeap) Push(x interface{}) { *h = append(*h, x.(prioItem)) }
+func (h *prioHeap) Pop() interface{} {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return it
+}
@@ -33,3 +33,23 @@ func TestIter(t *testing.T) {
 
 	test.Equals(t, []uint64{1, 2, 34, 20, 44, 21}, saw)
 }
+
+func TestPrioIter(t *testing.T) {
+	iter := tangle.NewPrioIter()
+	iter.Push(5, 2)
+	iter.Push(3, 1)
+	iter.Push(4, 2)
+
+	var saw []uint64
+	for iter.Next() {
+		curr := iter.Curr()
+		saw = append(saw, curr)
+
+		if curr == 3 { //push on the fly
+			iter.Push(1, 3)
+			iter.Push(9, 0)
+		}
+	}
+
+	test.Equals(t, []uint64{3, 9, 4, 5, 1}, saw)
+}
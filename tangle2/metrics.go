@@ -0,0 +1,207 @@
+package tangle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//bucket boundaries of the histograms
+var (
+	latencyBuckets = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5}
+	visitedBuckets = []float64{1, 10, 100, 1000, 10000, 100000}
+)
+
+//Metrics holds counters and histograms of tangle and store operations that can
+//be written in the Prometheus text format
+type Metrics struct {
+	blocksReceived uint64
+	walks          uint64
+	tips           int64
+	txs            [2]uint64 //read, update
+
+	receiveTime *histogram
+	selectTime  *histogram
+	walkVisited *histogram
+	txTime      [2]*histogram //read, update
+}
+
+func newMetrics() (m *Metrics) {
+	m = &Metrics{
+		receiveTime: newHistogram(latencyBuckets),
+		selectTime:  newHistogram(latencyBuckets),
+		walkVisited: newHistogram(visitedBuckets),
+		txTime:      [2]*histogram{newHistogram(latencyBuckets), newHistogram(latencyBuckets)},
+	}
+
+	return
+}
+
+//WriteTo writes all metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (n int64, err error) {
+	cw := &countWriter{w: bufio.NewWriter(w)}
+
+	family(cw, "tangle_blocks_received_total", "counter", "Number of blocks added to the tangle.")
+	fmt.Fprintf(cw, "tangle_blocks_received_total %d\n", atomic.LoadUint64(&m.blocksReceived))
+
+	family(cw, "tangle_receive_block_seconds", "histogram", "Time spent adding a block.")
+	m.receiveTime.write(cw, "tangle_receive_block_seconds", "")
+
+	family(cw, "tangle_select_tips_seconds", "histogram", "Time spent selecting tips.")
+	m.selectTime.write(cw, "tangle_select_tips_seconds", "")
+
+	family(cw, "tangle_walks_total", "counter", "Number of graph walks performed.")
+	fmt.Fprintf(cw, "tangle_walks_total %d\n", atomic.LoadUint64(&m.walks))
+
+	family(cw, "tangle_walk_visited_blocks", "histogram", "Number of blocks visited per walk.")
+	m.walkVisited.write(cw, "tangle_walk_visited_blocks", "")
+
+	family(cw, "tangle_tips", "gauge", "Number of tips after the last committed update.")
+	fmt.Fprintf(cw, "tangle_tips %d\n", atomic.LoadInt64(&m.tips))
+
+	family(cw, "tangle_store_transactions_total", "counter", "Number of store transactions committed.")
+	for i, update := range []string{"false", "true"} {
+		fmt.Fprintf(cw, "tangle_store_transactions_total{update=%q} %d\n", update, atomic.LoadUint64(&m.txs[i]))
+	}
+
+	family(cw, "tangle_store_transaction_seconds", "histogram", "Time store transactions were held open.")
+	for i, update := range []string{"false", "true"} {
+		m.txTime[i].write(cw, "tangle_store_transaction_seconds", fmt.Sprintf("update=%q", update))
+	}
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+
+	return cw.n, cw.err
+}
+
+//observeWalk records a walk that visited 'n' blocks
+func (m *Metrics) observeWalk(n int) {
+	if m == nil {
+		return
+	}
+
+	atomic.AddUint64(&m.walks, 1)
+	m.walkVisited.observe(float64(n))
+}
+
+func family(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+//histogram counts observations in buckets
+type histogram struct {
+	bounds []float64
+	counts []uint64 //per bucket, the last one is +Inf
+	sum    float64
+	n      uint64
+	mu     sync.Mutex
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+
+	h.counts[i]++
+	h.sum += v
+	h.n++
+}
+
+func (h *histogram) since(start time.Time) {
+	h.observe(time.Since(start).Seconds())
+}
+
+//write the cumulative buckets, sum and count with optional extra labels
+func (h *histogram) write(w io.Writer, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var cum uint64
+	for i, c := range h.counts {
+		cum += c
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+		}
+
+		if labels != "" {
+			fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", name, labels, le, cum)
+		} else {
+			fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, le, cum)
+		}
+	}
+
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.n)
+}
+
+//timedTx records how long a store transaction was held open
+type timedTx struct {
+	StoreTx
+	m      *Metrics
+	update int
+	start  time.Time
+	writer chan struct{} //token of the tangle's writer, if an update
+
+	committed func() //runs after a successful commit, while still holding the token
+}
+
+//Commit the underlying transaction and record the time it was held
+func (tx *timedTx) Commit() (err error) {
+	err = tx.StoreTx.Commit()
+	if err == nil && tx.committed != nil {
+		tx.committed()
+	}
+
+	tx.end()
+	return
+}
+
+//Discard the underlying transaction and record the time it was held
+func (tx *timedTx) Discard() {
+	tx.StoreTx.Discard()
+	tx.end()
+}
+
+func (tx *timedTx) end() {
+	atomic.AddUint64(&tx.m.txs[tx.update], 1)
+	tx.m.txTime[tx.update].since(tx.start)
+	if tx.writer != nil {
+		<-tx.writer
+	}
+}
+
+//countWriter counts the bytes written and keeps the first error
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) Write(p []byte) (n int, err error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+
+	n, cw.err = cw.w.Write(p)
+	cw.n += int64(n)
+	return n, cw.err
+}
@@ -0,0 +1,100 @@
+package tangle_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/store"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestMetrics(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	id3 := receive(t, tngl, []byte{0x03}, 1, 2)
+	receive(t, tngl, []byte{0x04}, id3)
+	receive(t, tngl, []byte{0x05}, id3)
+	tngl.SelectTips(2, 1)
+
+	buf := bytes.NewBuffer(nil)
+	n, err := tngl.Metrics().WriteTo(buf)
+	test.Ok(t, err)
+	test.Equals(t, int64(buf.Len()), n)
+
+	lines := map[string]bool{}
+	for _, l := range strings.Split(buf.String(), "\n") {
+		lines[l] = true
+	}
+
+	for _, l := range []string{
+		"# TYPE tangle_blocks_received_total counter",
+		"tangle_blocks_received_total 3",
+		"tangle_receive_block_seconds_count 3",
+		"tangle_select_tips_seconds_count 1",
+		"tangle_walks_total 6", //one weight update per block and one for tip selection
+		`tangle_walk_visited_blocks_bucket{le="1"} 2`,
+		`tangle_walk_visited_blocks_bucket{le="+Inf"} 6`,
+		"tangle_walk_visited_blocks_sum 13",
+		"tangle_tips 2",
+		`tangle_store_transactions_total{update="false"} 1`,
+		`tangle_store_transactions_total{update="true"} 4`,
+		`tangle_store_transaction_seconds_count{update="true"} 4`,
+	} {
+		if !lines[l] {
+			t.Errorf("expected metrics to contain: %s", l)
+		}
+	}
+}
+
+func TestTipsGauge(t *testing.T) {
+	tips := func(tngl *tangle.Tangle) string {
+		buf := bytes.NewBuffer(nil)
+		_, err := tngl.Metrics().WriteTo(buf)
+		test.Ok(t, err)
+		for _, l := range strings.Split(buf.String(), "\n") {
+			if strings.HasPrefix(l, "tangle_tips ") {
+				return l
+			}
+		}
+
+		return ""
+	}
+
+	s := store.NewSimple()
+	tngl := tangle.NewTangle(s)
+	test.Equals(t, "tangle_tips 2", tips(tngl))
+
+	id3 := receive(t, tngl, []byte{0x03}, 1, 2)
+	id4 := receive(t, tngl, []byte{0x04}, id3)
+	id5 := receive(t, tngl, []byte{0x05}, id3)
+	test.Equals(t, "tangle_tips 2", tips(tngl))
+	receive(t, tngl, []byte{0x06}, id4, id5)
+	test.Equals(t, "tangle_tips 1", tips(tngl))
+
+	tngl, err := tangle.OpenTangle(s)
+	test.Ok(t, err)
+	test.Equals(t, "tangle_tips 1", tips(tngl))
+
+	_, err = tngl.Snapshot(2)
+	test.Ok(t, err)
+	test.Equals(t, "tangle_tips 1", tips(tngl))
+
+	exp := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.Export(exp))
+	imported, err := tangle.Import(store.NewSimple(), exp)
+	test.Ok(t, err)
+	test.Equals(t, "tangle_tips 1", tips(imported))
+
+	snap := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.WriteSnapshot(snap))
+	read, err := tangle.ReadSnapshot(store.NewSimple(), snap)
+	test.Ok(t, err)
+	test.Equals(t, "tangle_tips 1", tips(read))
+
+	//a failed update leaves the gauge alone
+	_, err = tngl.ReceiveBlock([]byte{0x07}, 99)
+	test.Equals(t, tangle.ErrParentNotExist, err)
+	test.Equals(t, "tangle_tips 1", tips(tngl))
+}
@@ -0,0 +1,371 @@
+package tangle
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+//A snapshot file starts with a magic value and version followed by a sequence of
+//chunks. Each chunk is a kind byte, a big-endian uint32 payload length, the
+//payload and a crc32 over the kind and payload. The first chunk is the header
+//(seed, genesis ids and genesis payloads), followed by block chunks holding
+//length-prefixed block records in topological order and a trailer chunk with
+//the counts written.
+const (
+	snapMagic   = "TNGLSNAP"
+	snapVersion = 1
+
+	chunkHeader  = 'H'
+	chunkBlocks  = 'B'
+	chunkTrailer = 'T'
+
+	chunkTarget  = 64 << 10 //flush block chunks when they exceed this size
+	chunkMaxSize = 64 << 20 //refuse to read chunks that claim to be larger
+)
+
+var (
+	//ErrChecksum is returned when a snapshot chunk doesn't match its checksum
+	ErrChecksum = errors.New("snapshot chunk checksum mismatch")
+)
+
+//WriteSnapshot writes all blocks in the compact binary snapshot format
+func (t *Tangle) WriteSnapshot(w io.Writer) (err error) {
+	tx := t.begin(false)
+	defer t.mustCommit(tx)
+
+	sw := &snapWriter{w: bufio.NewWriter(w)}
+	if _, err = sw.w.WriteString(snapMagic); err != nil {
+		return fmt.Errorf("failed to write magic: %v", err)
+	}
+
+	sw.w.WriteByte(snapVersion)
+
+	cfg, _ := tx.GetConfig()
+	genesis := tx.GetGenesis()
+	binary.Write(&sw.buf, binary.BigEndian, cfg.Seed)
+	sw.uvarint(uint64(len(genesis)))
+	for _, id := range genesis {
+		sw.uvarint(id)
+	}
+
+	sw.uvarint(uint64(len(cfg.Genesis)))
+	for _, d := range cfg.Genesis {
+		sw.uvarint(uint64(len(d)))
+		sw.buf.Write(d)
+	}
+
+	if err = sw.flush(chunkHeader); err != nil {
+		return err
+	}
+
+	var nblocks uint64
+	var rec bytes.Buffer
+	for it := t.graph.HeightIter(tx, genesis); it.Next(); {
+		id := it.Curr()
+		d, _ := tx.GetData(id)
+		m, _ := tx.GetMeta(id)
+		parents := tx.GetC2p(id)
+
+		rec.Reset()
+		putUvarint(&rec, id)
+		putUvarint(&rec, uint64(len(parents)))
+		for _, pid := range parents {
+			putUvarint(&rec, pid)
+		}
+
+		putUvarint(&rec, m.Weight)
+		putUvarint(&rec, m.Height)
+		rec.Write(d)
+
+		if rec.Len() > chunkMaxSize-binary.MaxVarintLen64 {
+			return fmt.Errorf("block %d is too large for a snapshot chunk", id)
+		}
+
+		if sw.buf.Len()+rec.Len() > chunkTarget {
+			if err = sw.flush(chunkBlocks); err != nil {
+				return err
+			}
+		}
+
+		sw.uvarint(uint64(rec.Len()))
+		sw.buf.Write(rec.Bytes())
+		nblocks++
+	}
+
+	if err = sw.flush(chunkBlocks); err != nil {
+		return err
+	}
+
+	binary.Write(&sw.buf, binary.BigEndian, nblocks)
+	binary.Write(&sw.buf, binary.BigEndian, sw.nchunks)
+	if err = sw.flush(chunkTrailer); err != nil {
+		return err
+	}
+
+	if err = sw.w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush snapshot: %v", err)
+	}
+
+	return
+}
+
+//ReadSnapshot reads a binary snapshot into the (empty) store and returns the
+//tangle it describes. It returns ErrTangleExists if the store already holds a
+//tangle. Nothing is written unless the whole snapshot was read.
+func ReadSnapshot(store Store, r io.Reader) (t *Tangle, err error) {
+	sr := &snapReader{r: bufio.NewReader(r)}
+
+	magic := make([]byte, len(snapMagic)+1)
+	if _, err = io.ReadFull(sr.r, magic); err != nil {
+		return nil, fmt.Errorf("failed to read magic: %v", err)
+	}
+
+	if string(magic[:len(snapMagic)]) != snapMagic {
+		return nil, fmt.Errorf("not a snapshot file")
+	}
+
+	v := magic[len(snapMagic)]
+	if v != snapVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", v)
+	}
+
+	hdr, err := sr.chunk(chunkHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err = binary.Read(hdr, binary.BigEndian, &cfg.Seed); err != nil {
+		return nil, fmt.Errorf("failed to read seed: %v", err)
+	}
+
+	n, err := binary.ReadUvarint(hdr)
+	if err != nil || n > uint64(hdr.Len()) {
+		return nil, fmt.Errorf("failed to read number of genesis blocks: %v", err)
+	}
+
+	genesis := make([]uint64, n)
+	for i := range genesis {
+		if genesis[i], err = binary.ReadUvarint(hdr); err != nil {
+			return nil, fmt.Errorf("failed to read genesis id: %v", err)
+		}
+	}
+
+	if n, err = binary.ReadUvarint(hdr); err != nil || n > uint64(hdr.Len()) {
+		return nil, fmt.Errorf("failed to read number of genesis payloads: %v", err)
+	}
+
+	cfg.Genesis = make([][]byte, n)
+	for i := range cfg.Genesis {
+		l, err := binary.ReadUvarint(hdr)
+		if err != nil || l > uint64(hdr.Len()) {
+			return nil, fmt.Errorf("failed to read genesis payload length: %v", err)
+		}
+
+		cfg.Genesis[i] = make([]byte, l)
+		hdr.Read(cfg.Genesis[i])
+	}
+
+	t = newTangle(store, cfg.Seed)
+	tx := t.begin(true)
+	if err = t.readBlocks(tx, sr, cfg, genesis); err != nil {
+		tx.Discard()
+		return nil, err
+	}
+
+	t.onCommit(tx)
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit: %v", err)
+	}
+
+	return t, nil
+}
+
+//readBlocks writes the config and the blocks of the snapshot chunks up to the
+//trailer in 'tx'
+func (t *Tangle) readBlocks(tx StoreTx, sr *snapReader, cfg Config, genesis []uint64) (err error) {
+	if _, ok := tx.GetConfig(); ok {
+		return ErrTangleExists
+	}
+
+	tx.SetConfig(cfg)
+
+	var nblocks uint64
+	for {
+		kind, payload, err := sr.next()
+		if err != nil {
+			return err
+		}
+
+		if kind == chunkTrailer {
+			var cnt struct{ Blocks, Chunks uint64 }
+			if err = binary.Read(payload, binary.BigEndian, &cnt); err != nil {
+				return fmt.Errorf("failed to read trailer: %v", err)
+			}
+
+			if cnt.Blocks != nblocks || cnt.Chunks != sr.nchunks-1 {
+				return fmt.Errorf("trailer counts (%d blocks, %d chunks) don't match what was read (%d blocks, %d chunks)", cnt.Blocks, cnt.Chunks, nblocks, sr.nchunks-1)
+			}
+
+			break
+		}
+
+		if kind != chunkBlocks {
+			return fmt.Errorf("unexpected chunk kind %q", kind)
+		}
+
+		var batch []Block
+		for payload.Len() > 0 {
+			var b Block
+			if b, err = readRecord(payload); err != nil {
+				return err
+			}
+
+			batch = append(batch, b)
+			nblocks++
+		}
+
+		if err = t.receiveBlocks(tx, nil, batch); err != nil {
+			return err
+		}
+	}
+
+	if _, err = sr.r.ReadByte(); err != io.EOF {
+		return fmt.Errorf("unexpected data after trailer")
+	}
+
+	tx.SetGenesis(genesis)
+	return nil
+}
+
+//readRecord reads a length-prefixed block record from a chunk
+func readRecord(payload *bytes.Reader) (b Block, err error) {
+	l, err := binary.ReadUvarint(payload)
+	if err != nil || l > uint64(payload.Len()) {
+		return b, fmt.Errorf("invalid block record length")
+	}
+
+	rec := make([]byte, l)
+	payload.Read(rec)
+	rr := bytes.NewReader(rec)
+
+	if b.ID, err = binary.ReadUvarint(rr); err != nil {
+		return b, fmt.Errorf("failed to read block id: %v", err)
+	}
+
+	np, err := binary.ReadUvarint(rr)
+	if err != nil || np > uint64(rr.Len()) {
+		return b, fmt.Errorf("invalid number of parents for block %d", b.ID)
+	}
+
+	for i := uint64(0); i < np; i++ {
+		pid, err := binary.ReadUvarint(rr)
+		if err != nil {
+			return b, fmt.Errorf("failed to read parent of block %d: %v", b.ID, err)
+		}
+
+		b.Parents = append(b.Parents, pid)
+	}
+
+	if b.Meta.Weight, err = binary.ReadUvarint(rr); err != nil {
+		return b, fmt.Errorf("failed to read weight of block %d: %v", b.ID, err)
+	}
+
+	if b.Meta.Height, err = binary.ReadUvarint(rr); err != nil {
+		return b, fmt.Errorf("failed to read height of block %d: %v", b.ID, err)
+	}
+
+	b.Data = make([]byte, rr.Len())
+	rr.Read(b.Data)
+	return b, nil
+}
+
+func putUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+}
+
+//snapWriter buffers a chunk and writes it with its checksum
+type snapWriter struct {
+	w       *bufio.Writer
+	buf     bytes.Buffer
+	nchunks uint64
+}
+
+func (sw *snapWriter) uvarint(v uint64) { putUvarint(&sw.buf, v) }
+
+func (sw *snapWriter) flush(kind byte) (err error) {
+	if kind == chunkBlocks && sw.buf.Len() == 0 {
+		return nil //no empty block chunks
+	}
+
+	var hdr [5]byte
+	hdr[0] = kind
+	binary.BigEndian.PutUint32(hdr[1:], uint32(sw.buf.Len()))
+
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[:1])
+	crc.Write(sw.buf.Bytes())
+
+	sw.w.Write(hdr[:])
+	sw.w.Write(sw.buf.Bytes())
+	if err = binary.Write(sw.w, binary.BigEndian, crc.Sum32()); err != nil {
+		return fmt.Errorf("failed to write chunk: %v", err)
+	}
+
+	sw.buf.Reset()
+	sw.nchunks++
+	return
+}
+
+//snapReader reads chunks and verifies their checksum
+type snapReader struct {
+	r       *bufio.Reader
+	nchunks uint64
+}
+
+func (sr *snapReader) chunk(kind byte) (payload *bytes.Reader, err error) {
+	k, payload, err := sr.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if k != kind {
+		return nil, fmt.Errorf("expected chunk kind %q, got %q", kind, k)
+	}
+
+	return
+}
+
+func (sr *snapReader) next() (kind byte, payload *bytes.Reader, err error) {
+	var hdr [5]byte
+	if _, err = io.ReadFull(sr.r, hdr[:]); err != nil {
+		return 0, nil, fmt.Errorf("failed to read chunk header: %v", err)
+	}
+
+	l := binary.BigEndian.Uint32(hdr[1:])
+	if l > chunkMaxSize {
+		return 0, nil, fmt.Errorf("chunk of %d bytes exceeds the maximum size", l)
+	}
+
+	data := make([]byte, l+4)
+	if _, err = io.ReadFull(sr.r, data); err != nil {
+		return 0, nil, fmt.Errorf("failed to read chunk: %v", err)
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[:1])
+	crc.Write(data[:l])
+	if crc.Sum32() != binary.BigEndian.Uint32(data[l:]) {
+		return 0, nil, ErrChecksum
+	}
+
+	sr.nchunks++
+	return hdr[0], bytes.NewReader(data[:l]), nil
+}
@@ -0,0 +1,76 @@
+package tangle_test
+
+import (
+	"bytes"
+	"testing"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/store"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestSnapshotFile(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	prev := tngl.Genesis()
+	for i := 0; i < 500; i++ { //enough to span multiple chunks
+		prev = []uint64{receive(t, tngl, bytes.Repeat([]byte{byte(i)}, 200), prev...)}
+	}
+
+	exp := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.Export(exp))
+
+	snap := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.WriteSnapshot(snap))
+	data := snap.Bytes()
+
+	t.Run("round trip", func(t *testing.T) {
+		s := store.NewSimple()
+		tngl2, err := tangle.ReadSnapshot(s, bytes.NewReader(data))
+		test.Ok(t, err)
+		test.Equals(t, tngl.Genesis(), tngl2.Genesis())
+
+		_, err = tangle.OpenTangle(s) //config was restored
+		test.Ok(t, err)
+
+		act := bytes.NewBuffer(nil)
+		test.Ok(t, tngl2.Export(act))
+		test.Equals(t, exp.String(), act.String())
+
+		//ids continue where the original tangle stopped
+		test.Equals(t, prev[0]+1, receive(t, tngl2, []byte{}, prev...))
+	})
+
+	t.Run("corrupted chunk", func(t *testing.T) {
+		corrupt := append([]byte{}, data...)
+		corrupt[len(corrupt)/2] ^= 0xFF
+
+		s := store.NewSimple()
+		_, err := tangle.ReadSnapshot(s, bytes.NewReader(corrupt))
+		test.Equals(t, tangle.ErrChecksum, err)
+
+		//nothing was written, so the snapshot can be read again
+		checkEmpty(t, s)
+		_, err = tangle.ReadSnapshot(s, bytes.NewReader(data))
+		test.Ok(t, err)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := tangle.ReadSnapshot(store.NewSimple(), bytes.NewReader(data[:len(data)-10]))
+		test.Equals(t, true, err != nil)
+	})
+}
+
+//checkEmpty asserts that nothing was written to the store
+func checkEmpty(t *testing.T, s tangle.Store) {
+	_, err := tangle.OpenTangle(s)
+	test.Equals(t, tangle.ErrNoTangle, err)
+
+	tx := s.NewTransaction(false)
+	defer checkCommit(t, tx)
+	test.Equals(t, uint64(0), tx.GetSeq())
+	test.Equals(t, 0, len(tx.GetGenesis()))
+	test.Equals(t, 0, len(tx.GetTips()))
+	_, ok := tx.GetMeta(1)
+	test.Equals(t, false, ok)
+}
@@ -5,18 +5,55 @@ type Store interface {
 	NewTransaction(update bool) StoreTx
 }
 
-//StoreTx provides ACID interactions with the store
+//StoreTx provides ACID interactions with the store. Slices and maps that are
+//returned are owned by the caller and may be changed, except for block data
+//which must only be read. Setters keep a copy so callers may reuse arguments.
+//A transaction ends with either Commit or Discard, the latter drops what was
+//written.
 type StoreTx interface {
+	GraphTx
+	PayloadTx
+}
+
+//GraphStore provides persistent storage for the structure of the graph
+type GraphStore interface {
+	NewGraphTransaction(update bool) GraphTx
+}
+
+//GraphTx provides ACID interactions with the structure of the graph
+type GraphTx interface {
 	GetMeta(id uint64) (m Meta, ok bool)
-	GetData(id uint64) (d []byte, ok bool)
 	GetTips() map[uint64]struct{}
 	SetTip(id uint64)
-	SetData(id uint64, d []byte)
 	SetMeta(id uint64, m Meta)
 	DelTip(id uint64)
 	GetP2c(id uint64) []uint64
 	SetP2c(id uint64, p2c []uint64)
 	GetC2p(id uint64) []uint64
 	SetC2p(id uint64, c2p []uint64)
+	DelMeta(id uint64)
+	DelP2c(id uint64)
+	DelC2p(id uint64)
+	GetGenesis() []uint64
+	SetGenesis(ids []uint64)
+	GetSeq() uint64
+	SetSeq(seq uint64)
+	GetConfig() (c Config, ok bool)
+	SetConfig(c Config)
+	Commit() (err error)
+	Discard()
+}
+
+//PayloadStore provides persistent storage for the (large) block payloads
+type PayloadStore interface {
+	NewPayloadTransaction(update bool) PayloadTx
+}
+
+//PayloadTx provides ACID interactions with block payloads
+type PayloadTx interface {
+	GetData(id uint64) (d []byte, ok bool)
+	SetData(id uint64, d []byte)
+	DelData(id uint64)
 	Commit() (err error)
+	Discard()
 }
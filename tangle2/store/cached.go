@@ -0,0 +1,314 @@
+package store
+
+import (
+	"container/list"
+	"sync"
+
+	tangle "tangle/tangle2"
+)
+
+//CacheStats counts the lookups that were served by a cache
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+//HitRate returns the fraction of lookups that were hits
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+//Cached keeps recently read block metadata, edges and data of another store in
+//memory. Transactions only use cached values that were read at or before the
+//version they see, writes invalidate what they change when committed.
+type Cached struct {
+	store tangle.Store
+	meta  *lru
+	edges *lru
+	data  *lru
+
+	gen        uint64 //number of committed write transactions
+	committing int    //write transactions that are committing to the store
+
+	mu sync.Mutex //guards the fields above and the caches
+}
+
+//NewCached wraps the store with caches that each hold at most 'size' entries
+func NewCached(store tangle.Store, size int) (c *Cached) {
+	c = &Cached{
+		store: store,
+		meta:  newLRU(size),
+		edges: newLRU(size),
+		data:  newLRU(size),
+	}
+
+	return
+}
+
+//Stats returns the lookup counts of the meta, edges and data caches
+func (c *Cached) Stats() (meta, edges, data CacheStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.meta.stats, c.edges.stats, c.data.stats
+}
+
+//NewTransaction starts a transaction on the wrapped store
+func (c *Cached) NewTransaction(update bool) tangle.StoreTx {
+	tx := &CachedTx{c: c}
+
+	//the generation is read before the transaction starts so it can only be
+	//older than what the transaction sees, never newer
+	c.mu.Lock()
+	tx.gen = c.gen
+	tx.noFill = c.committing > 0
+	c.mu.Unlock()
+
+	tx.StoreTx = c.store.NewTransaction(update)
+	if update {
+		tx.written = make(map[key]struct{})
+	}
+
+	return tx
+}
+
+//CachedTx reads through the caches and passes everything else on
+type CachedTx struct {
+	tangle.StoreTx
+	c       *Cached
+	gen     uint64           //generation when the transaction started
+	noFill  bool             //started while a commit was in progress
+	written map[key]struct{} //cache keys written by an update transaction
+}
+
+//GetMeta gets a blocks metadata
+func (tx *CachedTx) GetMeta(id uint64) (m tangle.Meta, ok bool) {
+	k := key{id: id, kind: kindMeta}
+	v, ok, hit := tx.get(tx.c.meta, k)
+	if hit {
+		return v.(tangle.Meta), ok
+	}
+
+	m, ok = tx.StoreTx.GetMeta(id)
+	tx.fill(tx.c.meta, k, m, ok)
+	return
+}
+
+//GetData gets data of a given node, it is shared and must not be modified
+func (tx *CachedTx) GetData(id uint64) (d []byte, ok bool) {
+	k := key{id: id, kind: kindData}
+	v, ok, hit := tx.get(tx.c.data, k)
+	if hit {
+		return v.([]byte), ok
+	}
+
+	d, ok = tx.StoreTx.GetData(id)
+	tx.fill(tx.c.data, k, d, ok)
+	return
+}
+
+//GetP2c gets a copy of the parent to child edges
+func (tx *CachedTx) GetP2c(id uint64) []uint64 {
+	return tx.getEdges(key{id: id, kind: kindP2c}, tx.StoreTx.GetP2c)
+}
+
+//GetC2p gets a copy of the child to parent edges
+func (tx *CachedTx) GetC2p(id uint64) []uint64 {
+	return tx.getEdges(key{id: id, kind: kindC2p}, tx.StoreTx.GetC2p)
+}
+
+func (tx *CachedTx) getEdges(k key, load func(id uint64) []uint64) []uint64 {
+	if v, _, hit := tx.get(tx.c.edges, k); hit {
+		return copyIDs(v.([]uint64))
+	}
+
+	ids := load(k.id)
+	tx.fill(tx.c.edges, k, copyIDs(ids), true)
+	return ids
+}
+
+//SetData sets the block data
+func (tx *CachedTx) SetData(id uint64, d []byte) {
+	tx.StoreTx.SetData(id, d)
+	tx.written[key{id: id, kind: kindData}] = struct{}{}
+}
+
+//SetMeta sets the metadata for a block
+func (tx *CachedTx) SetMeta(id uint64, m tangle.Meta) {
+	tx.StoreTx.SetMeta(id, m)
+	tx.written[key{id: id, kind: kindMeta}] = struct{}{}
+}
+
+//SetP2c sets the parent to child edges
+func (tx *CachedTx) SetP2c(id uint64, p2c []uint64) {
+	tx.StoreTx.SetP2c(id, p2c)
+	tx.written[key{id: id, kind: kindP2c}] = struct{}{}
+}
+
+//SetC2p sets the child to parent edges
+func (tx *CachedTx) SetC2p(id uint64, c2p []uint64) {
+	tx.StoreTx.SetC2p(id, c2p)
+	tx.written[key{id: id, kind: kindC2p}] = struct{}{}
+}
+
+//DelData deletes the block data
+func (tx *CachedTx) DelData(id uint64) {
+	tx.StoreTx.DelData(id)
+	tx.written[key{id: id, kind: kindData}] = struct{}{}
+}
+
+//DelMeta deletes the metadata of a block
+func (tx *CachedTx) DelMeta(id uint64) {
+	tx.StoreTx.DelMeta(id)
+	tx.written[key{id: id, kind: kindMeta}] = struct{}{}
+}
+
+//DelP2c deletes the parent to child edges
+func (tx *CachedTx) DelP2c(id uint64) {
+	tx.StoreTx.DelP2c(id)
+	tx.written[key{id: id, kind: kindP2c}] = struct{}{}
+}
+
+//DelC2p deletes the child to parent edges
+func (tx *CachedTx) DelC2p(id uint64) {
+	tx.StoreTx.DelC2p(id)
+	tx.written[key{id: id, kind: kindC2p}] = struct{}{}
+}
+
+//Commit the transaction, what an update transaction wrote is removed from the
+//caches before it becomes visible in the wrapped store
+func (tx *CachedTx) Commit() (err error) {
+	if len(tx.written) == 0 {
+		return tx.StoreTx.Commit()
+	}
+
+	c := tx.c
+	c.mu.Lock()
+	for k := range tx.written {
+		c.cache(k).del(k)
+	}
+
+	c.gen++
+	c.committing++
+	c.mu.Unlock()
+
+	err = tx.StoreTx.Commit()
+
+	c.mu.Lock()
+	c.committing--
+	c.mu.Unlock()
+	return
+}
+
+//get looks up a value that is valid for the transaction
+func (tx *CachedTx) get(l *lru, k key) (v interface{}, ok, hit bool) {
+	if _, written := tx.written[k]; written {
+		return nil, false, false //the wrapped transaction knows its own writes
+	}
+
+	tx.c.mu.Lock()
+	defer tx.c.mu.Unlock()
+	return l.get(k, tx.gen)
+}
+
+//fill caches a value that was read from the wrapped store, but only if it is
+//also what transactions starting now would read
+func (tx *CachedTx) fill(l *lru, k key, v interface{}, ok bool) {
+	if _, written := tx.written[k]; written || tx.noFill {
+		return
+	}
+
+	tx.c.mu.Lock()
+	defer tx.c.mu.Unlock()
+	if tx.gen != tx.c.gen || tx.c.committing > 0 {
+		return
+	}
+
+	l.put(k, v, ok, tx.gen)
+}
+
+func (c *Cached) cache(k key) *lru {
+	switch k.kind {
+	case kindData:
+		return c.data
+	case kindP2c, kindC2p:
+		return c.edges
+	default:
+		return c.meta
+	}
+}
+
+//kinds of values that are cached for a block
+const (
+	kindMeta = iota
+	kindData
+	kindP2c
+	kindC2p
+)
+
+type key struct {
+	id   uint64
+	kind uint8
+}
+
+//lru holds at most 'size' entries and evicts the least recently used
+type lru struct {
+	size  int
+	ll    *list.List
+	items map[key]*list.Element
+	stats CacheStats
+}
+
+type entry struct {
+	k     key
+	v     interface{}
+	ok    bool   //whether the value exists in the store
+	since uint64 //generation from which the value is valid
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, ll: list.New(), items: make(map[key]*list.Element)}
+}
+
+//get the value if it was already valid at generation 'gen'
+func (l *lru) get(k key, gen uint64) (v interface{}, ok, hit bool) {
+	el, found := l.items[k]
+	if !found || el.Value.(*entry).since > gen {
+		l.stats.Misses++
+		return nil, false, false
+	}
+
+	l.stats.Hits++
+	l.ll.MoveToFront(el)
+	e := el.Value.(*entry)
+	return e.v, e.ok, true
+}
+
+func (l *lru) put(k key, v interface{}, ok bool, since uint64) {
+	if l.size < 1 {
+		return
+	}
+
+	if el, found := l.items[k]; found {
+		el.Value = &entry{k: k, v: v, ok: ok, since: since}
+		l.ll.MoveToFront(el)
+		return
+	}
+
+	l.items[k] = l.ll.PushFront(&entry{k: k, v: v, ok: ok, since: since})
+	if l.ll.Len() > l.size {
+		oldest := l.ll.Back()
+		l.ll.Remove(oldest)
+		delete(l.items, oldest.Value.(*entry).k)
+	}
+}
+
+func (l *lru) del(k key) {
+	if el, found := l.items[k]; found {
+		l.ll.Remove(el)
+		delete(l.items, k)
+	}
+}
@@ -0,0 +1,84 @@
+package store_test
+
+import (
+	"testing"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/store"
+	"tangle/tangle2/storetest"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestCached(t *testing.T) {
+	storetest.Run(t, func() tangle.Store { return store.NewCached(store.NewSimple(), 4) })
+}
+
+func TestCachedInvalidation(t *testing.T) {
+	c := store.NewCached(store.NewSimple(), 16)
+	w := c.NewTransaction(true)
+	w.SetMeta(1, tangle.Meta{Weight: 1})
+	w.SetMeta(2, tangle.Meta{Weight: 1})
+	test.Ok(t, w.Commit())
+
+	old := c.NewTransaction(false)
+	m, _ := old.GetMeta(1) //miss, fills the cache
+	test.Equals(t, uint64(1), m.Weight)
+	m, _ = old.GetMeta(1) //hit
+	test.Equals(t, uint64(1), m.Weight)
+
+	w = c.NewTransaction(true)
+	m, _ = w.GetMeta(1) //hit
+	w.SetMeta(1, tangle.Meta{Weight: m.Weight + 1})
+	w.SetMeta(2, tangle.Meta{Weight: 2})
+	m, _ = w.GetMeta(1) //sees its own write
+	test.Equals(t, uint64(2), m.Weight)
+	test.Ok(t, w.Commit())
+
+	//a new transaction sees the writes, and caches the new values
+	r := c.NewTransaction(false)
+	m, _ = r.GetMeta(1)
+	test.Equals(t, uint64(2), m.Weight)
+	m, _ = r.GetMeta(2)
+	test.Equals(t, uint64(2), m.Weight)
+	test.Ok(t, r.Commit())
+
+	//the older transaction keeps seeing its own version
+	m, _ = old.GetMeta(1)
+	test.Equals(t, uint64(1), m.Weight)
+	m, _ = old.GetMeta(2)
+	test.Equals(t, uint64(1), m.Weight)
+	test.Ok(t, old.Commit())
+
+	meta, edges, data := c.Stats()
+	test.Equals(t, store.CacheStats{Hits: 2, Misses: 5}, meta)
+	test.Equals(t, store.CacheStats{}, edges)
+	test.Equals(t, store.CacheStats{}, data)
+	test.Equals(t, 2.0/7.0, meta.HitRate())
+}
+
+func TestCachedTangle(t *testing.T) {
+	c := store.NewCached(store.NewSimple(), 64)
+	tngl := tangle.NewTangle(c)
+	prev := tngl.Genesis()
+	for i := 0; i < 50; i++ {
+		id, err := tngl.ReceiveBlock([]byte{byte(i)}, prev...)
+		test.Ok(t, err)
+		prev = []uint64{id}
+	}
+
+	tngl.SelectTips(2, 10)
+	test.Equals(t, prev, tngl.SelectTips(1, 10))
+
+	_, _, data := c.Stats()
+	test.Equals(t, store.CacheStats{}, data) //walks don't read payloads
+
+	for i := 0; i < 2; i++ {
+		b, err := tngl.Block(prev[0])
+		test.Ok(t, err)
+		test.Equals(t, []byte{49}, b.Data)
+	}
+
+	meta, edges, data := c.Stats()
+	test.Equals(t, true, meta.Hits > 0 && edges.Hits > 0 && data.Hits > 0)
+}
@@ -6,112 +6,429 @@ import (
 	tangle "tangle/tangle2"
 )
 
-//Simple persists graph data
+//Simple persists graph data in memory. It keeps multiple versions of the data
+//so read transactions see the version that was committed when they started,
+//readers and the (single) writer don't block each other.
 type Simple struct {
-	meta map[uint64]tangle.Meta //keep (local) metadata about blocks
-	tips map[uint64]struct{}    //keep orphan blocks as tips
-	data map[uint64][]byte      //holds block data
-	p2c  map[uint64][]uint64    //map parent -> child
-	c2p  map[uint64][]uint64    //map children -> parents
+	recs    map[uint64][]recVersion //versions of each block, oldest first
+	states  []stateVersion          //versions of the tips and globals, oldest first
+	version uint64                  //last committed version
+	readers map[uint64]int          //number of open read transactions per version
+	garbage map[uint64]struct{}     //blocks that may have versions to collect
 
-	mu sync.RWMutex
+	mu  sync.RWMutex //guards the fields above for the duration of one operation
+	wmu sync.Mutex   //held by the write transaction
+}
+
+//record holds everything about a block, it is never changed once committed
+type record struct {
+	meta     tangle.Meta //keep (local) metadata about blocks
+	data     []byte      //holds block data
+	p2c, c2p []uint64    //map parent -> child and child -> parents
+	hasMeta  bool        //meta was set
+	hasData  bool        //data was set
+}
+
+func (r *record) empty() bool {
+	return !r.hasMeta && !r.hasData && len(r.p2c) == 0 && len(r.c2p) == 0
+}
+
+//state holds what is not specific to a block, it is never changed once committed
+type state struct {
+	tips map[uint64]struct{} //keep orphan blocks as tips
+	gen  []uint64            //blocks from which the graph can be walked
+	seq  uint64              //last block id that was handed out
+	cfg  *tangle.Config      //parameters the tangle was created with
+}
+
+//recVersion is a block as of version 'v', a nil record means it doesn't exist
+type recVersion struct {
+	v   uint64
+	rec *record
+}
+
+type stateVersion struct {
+	v     uint64
+	state *state
 }
 
 //NewSimple initiates the store
 func NewSimple() (s *Simple) {
 	s = &Simple{
-		meta: make(map[uint64]tangle.Meta),
-		tips: make(map[uint64]struct{}),
-		data: make(map[uint64][]byte),
-		p2c:  make(map[uint64][]uint64),
-		c2p:  make(map[uint64][]uint64),
+		recs:    make(map[uint64][]recVersion),
+		states:  []stateVersion{{state: &state{tips: make(map[uint64]struct{})}}},
+		readers: make(map[uint64]int),
+		garbage: make(map[uint64]struct{}),
 	}
 
 	return
 }
 
-//NewTransaction starts a store transaction
+//NewTransaction starts a store transaction. Only one update transaction can
+//be open at a time, others wait for it to commit.
 func (s *Simple) NewTransaction(update bool) tangle.StoreTx {
 	tx := &SimpleTx{s: s, update: update}
 	if tx.update {
-		tx.s.mu.Lock()
-	} else {
-		tx.s.mu.RLock()
+		s.wmu.Lock()
+		tx.recs = make(map[uint64]*record)
 	}
 
+	s.mu.Lock()
+	tx.version = s.version
+	if !tx.update {
+		s.readers[tx.version]++
+	}
+
+	s.mu.Unlock()
 	return tx
 }
 
+//NewGraphTransaction starts a transaction for when only the graph is stored
+func (s *Simple) NewGraphTransaction(update bool) tangle.GraphTx {
+	return s.NewTransaction(update)
+}
+
+//NewPayloadTransaction starts a transaction for when only payloads are stored
+func (s *Simple) NewPayloadTransaction(update bool) tangle.PayloadTx {
+	return s.NewTransaction(update)
+}
+
 //SimpleTx is an atomic interaction with the graph store
 type SimpleTx struct {
-	s      *Simple
-	update bool
+	s       *Simple
+	update  bool
+	version uint64 //version that is read
+
+	recs  map[uint64]*record //blocks written by the transaction
+	state *state             //tips and globals written by the transaction
+	done  bool
 }
 
 //GetMeta gets a blocks metadata
 func (tx *SimpleTx) GetMeta(id uint64) (m tangle.Meta, ok bool) {
-	m, ok = tx.s.meta[id]
-	return
+	r := tx.read(id)
+	return r.meta, r.hasMeta
 }
 
-//GetData gets data of a given node
+//GetData gets data of a given node, it is shared and must not be modified
 func (tx *SimpleTx) GetData(id uint64) (d []byte, ok bool) {
-	d, ok = tx.s.data[id]
-	return
+	r := tx.read(id)
+	return r.data, r.hasData
 }
 
-//GetTips gets the current tips
-func (tx *SimpleTx) GetTips() map[uint64]struct{} {
-	return tx.s.tips
+//GetTips gets a copy of the current tips
+func (tx *SimpleTx) GetTips() (tips map[uint64]struct{}) {
+	st := tx.readState()
+	tips = make(map[uint64]struct{}, len(st.tips))
+	for id := range st.tips {
+		tips[id] = struct{}{}
+	}
+
+	return
 }
 
 //SetTip sets the provided id as a tip
 func (tx *SimpleTx) SetTip(id uint64) {
-	tx.s.tips[id] = struct{}{}
+	tx.writeState().tips[id] = struct{}{}
 }
 
-//SetData sets the block data
+//SetData sets a copy of the block data
 func (tx *SimpleTx) SetData(id uint64, d []byte) {
-	tx.s.data[id] = d
+	r := tx.write(id)
+	r.data, r.hasData = append(make([]byte, 0, len(d)), d...), true
 }
 
 //SetMeta sets the metadata for a block
 func (tx *SimpleTx) SetMeta(id uint64, m tangle.Meta) {
-	tx.s.meta[id] = m
+	r := tx.write(id)
+	r.meta, r.hasMeta = m, true
 }
 
 //DelTip deletes the 'id' as tip
 func (tx *SimpleTx) DelTip(id uint64) {
-	delete(tx.s.tips, id)
+	delete(tx.writeState().tips, id)
 }
 
-//GetP2c gets the parent to child edges
+//GetP2c gets a copy of the parent to child edges
 func (tx *SimpleTx) GetP2c(id uint64) []uint64 {
-	return tx.s.p2c[id]
+	return copyIDs(tx.read(id).p2c)
 }
 
-//SetP2c sets the parent to child edges
+//SetP2c sets a copy of the parent to child edges
 func (tx *SimpleTx) SetP2c(id uint64, p2c []uint64) {
-	tx.s.p2c[id] = p2c
+	tx.write(id).p2c = copyIDs(p2c)
 }
 
-//GetC2p gets the child to parent edges
+//GetC2p gets a copy of the child to parent edges
 func (tx *SimpleTx) GetC2p(id uint64) []uint64 {
-	return tx.s.c2p[id]
+	return copyIDs(tx.read(id).c2p)
 }
 
-//SetC2p sets the child to parent edges
+//SetC2p sets a copy of the child to parent edges
 func (tx *SimpleTx) SetC2p(id uint64, c2p []uint64) {
-	tx.s.c2p[id] = c2p
+	tx.write(id).c2p = copyIDs(c2p)
+}
+
+//DelData deletes the block data
+func (tx *SimpleTx) DelData(id uint64) {
+	r := tx.write(id)
+	r.data, r.hasData = nil, false
+}
+
+//DelMeta deletes the metadata of a block
+func (tx *SimpleTx) DelMeta(id uint64) {
+	r := tx.write(id)
+	r.meta, r.hasMeta = tangle.Meta{}, false
+}
+
+//DelP2c deletes the parent to child edges
+func (tx *SimpleTx) DelP2c(id uint64) {
+	tx.write(id).p2c = nil
 }
 
-//Commit the store transaction
+//DelC2p deletes the child to parent edges
+func (tx *SimpleTx) DelC2p(id uint64) {
+	tx.write(id).c2p = nil
+}
+
+//GetGenesis gets a copy of the blocks the graph starts from
+func (tx *SimpleTx) GetGenesis() []uint64 {
+	return copyIDs(tx.readState().gen)
+}
+
+//SetGenesis sets a copy of the blocks the graph starts from
+func (tx *SimpleTx) SetGenesis(ids []uint64) {
+	tx.writeState().gen = copyIDs(ids)
+}
+
+//GetSeq gets the last block id that was handed out
+func (tx *SimpleTx) GetSeq() uint64 {
+	return tx.readState().seq
+}
+
+//SetSeq sets the last block id that was handed out
+func (tx *SimpleTx) SetSeq(seq uint64) {
+	tx.writeState().seq = seq
+}
+
+//GetConfig gets the parameters the tangle was created with
+func (tx *SimpleTx) GetConfig() (c tangle.Config, ok bool) {
+	cfg := tx.readState().cfg
+	if cfg == nil {
+		return c, false
+	}
+
+	return copyConfig(*cfg), true
+}
+
+//SetConfig sets the parameters the tangle was created with
+func (tx *SimpleTx) SetConfig(c tangle.Config) {
+	c = copyConfig(c)
+	tx.writeState().cfg = &c
+}
+
+//Commit the store transaction, the changes of an update transaction become
+//visible to transactions that start afterwards
 func (tx *SimpleTx) Commit() (err error) {
-	if tx.update {
-		tx.s.mu.Unlock()
-	} else {
-		tx.s.mu.RUnlock()
+	if tx.done {
+		panic("transaction already committed")
+	}
+
+	tx.done = true
+	s := tx.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !tx.update {
+		if s.readers[tx.version]--; s.readers[tx.version] == 0 {
+			delete(s.readers, tx.version)
+		}
+
+		return
+	}
+
+	defer s.wmu.Unlock()
+	if len(tx.recs) == 0 && tx.state == nil {
+		return //nothing was written
+	}
+
+	s.version++
+	for id, r := range tx.recs {
+		if r.empty() {
+			r = nil
+		}
+
+		s.recs[id] = append(s.recs[id], recVersion{v: s.version, rec: r})
+		s.garbage[id] = struct{}{}
+	}
+
+	if tx.state != nil {
+		s.states = append(s.states, stateVersion{v: s.version, state: tx.state})
 	}
 
+	s.collect()
 	return
 }
+
+//Discard ends the transaction without making its changes visible
+func (tx *SimpleTx) Discard() {
+	tx.recs, tx.state = nil, nil
+	tx.Commit()
+}
+
+//ids returns every block that has a version, some may not exist anymore
+func (s *Simple) ids() (ids []uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for id := range s.recs {
+		ids = append(ids, id)
+	}
+
+	return
+}
+
+//read the block as seen by the transaction, the result must not be modified
+func (tx *SimpleTx) read(id uint64) *record {
+	if r, ok := tx.recs[id]; ok {
+		return r
+	}
+
+	tx.s.mu.RLock()
+	defer tx.s.mu.RUnlock()
+
+	vs := tx.s.recs[id]
+	for i := len(vs) - 1; i >= 0; i-- {
+		if vs[i].v <= tx.version {
+			if vs[i].rec != nil {
+				return vs[i].rec
+			}
+
+			break
+		}
+	}
+
+	return &record{}
+}
+
+//write returns the block as written by the transaction, it can be modified
+func (tx *SimpleTx) write(id uint64) *record {
+	if !tx.update {
+		panic("write in a read transaction")
+	}
+
+	r, ok := tx.recs[id]
+	if !ok {
+		cp := *tx.read(id) //slices are replaced, never changed in place
+		r = &cp
+		tx.recs[id] = r
+	}
+
+	return r
+}
+
+//readState returns the tips and globals as seen by the transaction, the result
+//must not be modified
+func (tx *SimpleTx) readState() *state {
+	if tx.state != nil {
+		return tx.state
+	}
+
+	tx.s.mu.RLock()
+	defer tx.s.mu.RUnlock()
+
+	ss := tx.s.states
+	for i := len(ss) - 1; i >= 0; i-- {
+		if ss[i].v <= tx.version {
+			return ss[i].state
+		}
+	}
+
+	panic("no state for version")
+}
+
+//writeState returns the tips and globals as written by the transaction, they
+//can be modified
+func (tx *SimpleTx) writeState() *state {
+	if !tx.update {
+		panic("write in a read transaction")
+	}
+
+	if tx.state == nil {
+		old := tx.readState()
+		st := *old
+		st.tips = make(map[uint64]struct{}, len(old.tips))
+		for id := range old.tips {
+			st.tips[id] = struct{}{}
+		}
+
+		tx.state = &st
+	}
+
+	return tx.state
+}
+
+//collect drops versions that no open or future transaction can read, it must
+//be called while holding the write lock
+func (s *Simple) collect() {
+	oldest := s.version
+	for v := range s.readers {
+		if v < oldest {
+			oldest = v
+		}
+	}
+
+	for id := range s.garbage {
+		vs := s.recs[id]
+		i := len(vs) - 1
+		for i > 0 && vs[i].v > oldest {
+			i--
+		}
+
+		if i > 0 {
+			vs = append([]recVersion(nil), vs[i:]...)
+		}
+
+		if len(vs) > 0 && vs[0].v <= oldest && vs[0].rec == nil {
+			vs = vs[1:] //reads the same as no version at all
+		}
+
+		switch {
+		case len(vs) == 0:
+			delete(s.recs, id)
+			delete(s.garbage, id)
+		case len(vs) == 1 && vs[0].rec != nil:
+			s.recs[id] = vs
+			delete(s.garbage, id)
+		default:
+			s.recs[id] = vs
+		}
+	}
+
+	i := len(s.states) - 1
+	for i > 0 && s.states[i].v > oldest {
+		i--
+	}
+
+	if i > 0 {
+		s.states = append([]stateVersion(nil), s.states[i:]...)
+	}
+}
+
+//copyIDs returns a copy of the ids that doesn't share memory, nil stays nil
+func copyIDs(ids []uint64) []uint64 {
+	if ids == nil {
+		return nil
+	}
+
+	return append(make([]uint64, 0, len(ids)), ids...)
+}
+
+//copyConfig returns a copy of the config with copied genesis payloads
+func copyConfig(c tangle.Config) tangle.Config {
+	genesis := make([][]byte, len(c.Genesis))
+	for i, d := range c.Genesis {
+		genesis[i] = append([]byte{}, d...)
+	}
+
+	c.Genesis = genesis
+	return c
+}
@@ -0,0 +1,55 @@
+package store_test
+
+import (
+	"testing"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/store"
+	"tangle/tangle2/storetest"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestSimple(t *testing.T) {
+	storetest.Run(t, func() tangle.Store { return store.NewSimple() })
+}
+
+func TestSimpleSnapshots(t *testing.T) {
+	s := store.NewSimple()
+	tx := s.NewTransaction(true)
+	tx.SetMeta(1, tangle.Meta{Weight: 1})
+	tx.SetTip(1)
+	test.Ok(t, tx.Commit())
+
+	//a reader doesn't block the writer and keeps seeing its own version
+	r := s.NewTransaction(false)
+	for i := uint64(2); i < 5; i++ {
+		w := s.NewTransaction(true)
+		w.SetMeta(1, tangle.Meta{Weight: i})
+		w.SetMeta(i, tangle.Meta{})
+		w.DelTip(i - 1)
+		w.SetTip(i)
+		test.Ok(t, w.Commit())
+	}
+
+	m, _ := r.GetMeta(1)
+	test.Equals(t, uint64(1), m.Weight)
+	_, ok := r.GetMeta(4)
+	test.Equals(t, false, ok)
+	test.Equals(t, map[uint64]struct{}{1: {}}, r.GetTips())
+	test.Ok(t, r.Commit())
+
+	r = s.NewTransaction(false)
+	m, _ = r.GetMeta(1)
+	test.Equals(t, uint64(4), m.Weight)
+	_, ok = r.GetMeta(4)
+	test.Equals(t, true, ok)
+	test.Equals(t, map[uint64]struct{}{4: {}}, r.GetTips())
+
+	t.Run("write in read transaction", func(t *testing.T) {
+		defer func() { test.Equals(t, "write in a read transaction", recover()) }()
+		r.SetTip(5)
+	})
+
+	test.Ok(t, r.Commit())
+}
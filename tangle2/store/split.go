@@ -0,0 +1,81 @@
+package store
+
+import (
+	"fmt"
+
+	tangle "tangle/tangle2"
+)
+
+//Split stores the structure of the graph and the block payloads separately so
+//large payloads can be kept where they don't slow down walking the graph. A
+//payload transaction is only started when a payload is read or written.
+type Split struct {
+	graph    tangle.GraphStore
+	payloads tangle.PayloadStore
+}
+
+//NewSplit combines a store for the graph and a store for the payloads
+func NewSplit(graph tangle.GraphStore, payloads tangle.PayloadStore) (s *Split) {
+	return &Split{graph: graph, payloads: payloads}
+}
+
+//NewTransaction starts a transaction on the graph store. Payloads are read
+//from the version that was committed when they are first accessed, which may
+//be newer than the version of the graph that is read.
+func (s *Split) NewTransaction(update bool) tangle.StoreTx {
+	return &SplitTx{GraphTx: s.graph.NewGraphTransaction(update), s: s, update: update}
+}
+
+//SplitTx passes graph interactions on and opens a payload transaction lazily
+type SplitTx struct {
+	tangle.GraphTx
+	s        *Split
+	update   bool
+	payloads tangle.PayloadTx //nil until a payload is accessed
+}
+
+//GetData gets data of a given node, it is shared and must not be modified
+func (tx *SplitTx) GetData(id uint64) (d []byte, ok bool) {
+	return tx.payloadTx().GetData(id)
+}
+
+//SetData sets a copy of the block data
+func (tx *SplitTx) SetData(id uint64, d []byte) {
+	tx.payloadTx().SetData(id, d)
+}
+
+//DelData deletes the block data
+func (tx *SplitTx) DelData(id uint64) {
+	tx.payloadTx().DelData(id)
+}
+
+//Commit the payloads and then the graph, such that blocks are never visible
+//without their payload. If the payloads fail to commit the graph changes are
+//discarded, if the graph fails to commit the payloads are left unreferenced.
+func (tx *SplitTx) Commit() (err error) {
+	if tx.payloads != nil {
+		if err = tx.payloads.Commit(); err != nil {
+			tx.GraphTx.Discard()
+			return fmt.Errorf("failed to commit payloads: %v", err)
+		}
+	}
+
+	return tx.GraphTx.Commit()
+}
+
+//Discard the graph and payload changes
+func (tx *SplitTx) Discard() {
+	if tx.payloads != nil {
+		tx.payloads.Discard()
+	}
+
+	tx.GraphTx.Discard()
+}
+
+func (tx *SplitTx) payloadTx() tangle.PayloadTx {
+	if tx.payloads == nil {
+		tx.payloads = tx.s.payloads.NewPayloadTransaction(tx.update)
+	}
+
+	return tx.payloads
+}
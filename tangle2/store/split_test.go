@@ -0,0 +1,85 @@
+package store_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/store"
+	"tangle/tangle2/storetest"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestSplit(t *testing.T) {
+	storetest.Run(t, func() tangle.Store { return store.NewSplit(store.NewSimple(), store.NewSimple()) })
+}
+
+//countingPayloads counts the payload transactions that are started
+type countingPayloads struct {
+	*store.Simple
+	n int64
+}
+
+func (p *countingPayloads) NewPayloadTransaction(update bool) tangle.PayloadTx {
+	atomic.AddInt64(&p.n, 1)
+	return p.Simple.NewPayloadTransaction(update)
+}
+
+func TestSplitLazyPayloads(t *testing.T) {
+	payloads := &countingPayloads{Simple: store.NewSimple()}
+	tngl := tangle.NewTangle(store.NewSplit(store.NewSimple(), payloads))
+	prev := tngl.Genesis()
+	for i := 0; i < 10; i++ {
+		id, err := tngl.ReceiveBlock([]byte{byte(i)}, prev...)
+		test.Ok(t, err)
+		prev = []uint64{id}
+	}
+
+	n := atomic.LoadInt64(&payloads.n)
+	test.Equals(t, prev, tngl.SelectTips(1, 10))
+	test.Equals(t, 10, tngl.Stats().Blocks-2)
+	test.Equals(t, n, atomic.LoadInt64(&payloads.n)) //walks don't read payloads
+
+	b, err := tngl.Block(prev[0])
+	test.Ok(t, err)
+	test.Equals(t, []byte{9}, b.Data)
+	test.Equals(t, n+1, atomic.LoadInt64(&payloads.n))
+}
+
+//failingPayloads fails to commit every update transaction
+type failingPayloads struct{ *store.Simple }
+
+func (p failingPayloads) NewPayloadTransaction(update bool) tangle.PayloadTx {
+	return failingTx{p.Simple.NewPayloadTransaction(update)}
+}
+
+type failingTx struct{ tangle.PayloadTx }
+
+func (tx failingTx) Commit() error {
+	tx.PayloadTx.Discard()
+	return errors.New("disk full")
+}
+
+func TestSplitPayloadFailure(t *testing.T) {
+	graph := store.NewSimple()
+	s := store.NewSplit(graph, failingPayloads{store.NewSimple()})
+
+	tx := s.NewTransaction(true)
+	tx.SetMeta(1, tangle.Meta{})
+	tx.SetData(1, []byte("foo"))
+	test.Equals(t, "failed to commit payloads: disk full", tx.Commit().Error())
+
+	//the block isn't visible without its payload and the graph isn't locked
+	tx = s.NewTransaction(true)
+	_, ok := tx.GetMeta(1)
+	test.Equals(t, false, ok)
+	tx.SetMeta(2, tangle.Meta{})
+	tx.Discard()
+
+	tx = graph.NewTransaction(false)
+	_, ok = tx.GetMeta(2)
+	test.Equals(t, false, ok)
+	test.Ok(t, tx.Commit())
+}
@@ -0,0 +1,496 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sync"
+
+	tangle "tangle/tangle2"
+
+	_ "modernc.org/sqlite" //registers the pure Go "sqlite" driver
+)
+
+//sqlSchema creates the tables when opening a database. Ids, weights and
+//heights are stored as (signed) integers. Each edge is a single row, both the
+//children of a parent and the parents of a child are queried from it. The
+//positions keep the order of these lists, a position is NULL if the edge is
+//only in the other list. Blocks have few parents, so the child index is also
+//used to find the row of a single edge.
+const sqlSchema = `
+CREATE TABLE IF NOT EXISTS blocks (
+	id   INTEGER PRIMARY KEY,
+	data BLOB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS meta (
+	id     INTEGER PRIMARY KEY,
+	weight INTEGER NOT NULL,
+	height INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS meta_height ON meta (height);
+
+CREATE TABLE IF NOT EXISTS edges (
+	parent     INTEGER NOT NULL,
+	child      INTEGER NOT NULL,
+	parent_pos INTEGER,
+	child_pos  INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS edges_parent ON edges (parent, child_pos);
+CREATE INDEX IF NOT EXISTS edges_child ON edges (child, parent, parent_pos);
+
+CREATE TABLE IF NOT EXISTS tips (
+	id INTEGER PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS globals (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);`
+
+//ErrSQLIDRange is returned when writing an id that doesn't fit the signed
+//integers of the database
+var ErrSQLIDRange = errors.New("id is larger than the database can store")
+
+//keys of the globals table, values are json encoded
+const (
+	globalGenesis = "genesis"
+	globalSeq     = "seq"
+	globalConfig  = "config"
+)
+
+//SQL stores the graph in an embedded SQLite database so it can also be queried
+//with SQL. Read transactions see the database as it was when they started and
+//don't block the writer, write transactions are serialized.
+type SQL struct {
+	db  *sql.DB
+	wmu sync.Mutex //held by the write transaction
+}
+
+//OpenSQL opens (or creates) the database file at 'path'
+func OpenSQL(path string) (s *SQL, err error) {
+	q := url.Values{}
+	q.Add("_pragma", "journal_mode(wal)")
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Set("_txlock", "immediate") //writers lock the database when they begin
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+
+	if _, err = db.Exec(sqlSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema: %v", err)
+	}
+
+	return &SQL{db: db}, nil
+}
+
+//DB returns the database, for running (read-only) queries
+func (s *SQL) DB() *sql.DB {
+	return s.db
+}
+
+//Close the database
+func (s *SQL) Close() (err error) {
+	if err = s.db.Close(); err != nil {
+		return fmt.Errorf("failed to close database: %v", err)
+	}
+
+	return
+}
+
+//NewTransaction starts a database transaction. Only one update transaction can
+//be open at a time, others wait for it to commit.
+func (s *SQL) NewTransaction(update bool) tangle.StoreTx {
+	tx := &SQLTx{s: s, update: update}
+	if update {
+		s.wmu.Lock()
+	}
+
+	if tx.tx, tx.err = s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: !update}); tx.err != nil {
+		tx.err = fmt.Errorf("failed to begin: %v", tx.err)
+		return tx
+	}
+
+	//sqlite only takes its snapshot on the first read, which should be now
+	var n int
+	tx.queryRow("SELECT count(*) FROM tips WHERE id = 0", nil, &n)
+	return tx
+}
+
+//NewGraphTransaction starts a transaction for when only the graph is stored
+func (s *SQL) NewGraphTransaction(update bool) tangle.GraphTx {
+	return s.NewTransaction(update)
+}
+
+//NewPayloadTransaction starts a transaction for when only payloads are stored
+func (s *SQL) NewPayloadTransaction(update bool) tangle.PayloadTx {
+	return s.NewTransaction(update)
+}
+
+//SQLTx is a database transaction. The first error that occurs is kept and
+//returned by Commit, the transaction is rolled back in that case. Reads return
+//nothing once an error occurred.
+type SQLTx struct {
+	s      *SQL
+	tx     *sql.Tx
+	update bool
+	err    error
+	done   bool
+}
+
+//GetMeta gets a blocks metadata
+func (tx *SQLTx) GetMeta(id uint64) (m tangle.Meta, ok bool) {
+	n, ok := sqlID(id)
+	var weight, height int64
+	if ok = ok && tx.queryRow("SELECT weight, height FROM meta WHERE id = ?", []interface{}{n}, &weight, &height); ok {
+		m = tangle.Meta{Weight: uint64(weight), Height: uint64(height)}
+	}
+
+	return
+}
+
+//GetData gets the block data
+func (tx *SQLTx) GetData(id uint64) (d []byte, ok bool) {
+	n, ok := sqlID(id)
+	if ok = ok && tx.queryRow("SELECT data FROM blocks WHERE id = ?", []interface{}{n}, &d); ok && d == nil {
+		d = []byte{}
+	}
+
+	return
+}
+
+//GetTips gets the current tips
+func (tx *SQLTx) GetTips() (tips map[uint64]struct{}) {
+	tips = make(map[uint64]struct{})
+	for _, id := range tx.queryIDs("SELECT id FROM tips") {
+		tips[id] = struct{}{}
+	}
+
+	return
+}
+
+//SetTip sets the provided id as a tip
+func (tx *SQLTx) SetTip(id uint64) {
+	tx.exec("INSERT OR IGNORE INTO tips (id) VALUES (?)", tx.id(id))
+}
+
+//SetData sets the block data
+func (tx *SQLTx) SetData(id uint64, d []byte) {
+	if d == nil {
+		d = []byte{}
+	}
+
+	tx.exec("INSERT OR REPLACE INTO blocks (id, data) VALUES (?, ?)", tx.id(id), d)
+}
+
+//SetMeta sets the metadata for a block
+func (tx *SQLTx) SetMeta(id uint64, m tangle.Meta) {
+	tx.exec("INSERT OR REPLACE INTO meta (id, weight, height) VALUES (?, ?, ?)", tx.id(id), int64(m.Weight), int64(m.Height))
+}
+
+//DelTip deletes the 'id' as tip
+func (tx *SQLTx) DelTip(id uint64) {
+	if n, ok := sqlID(id); ok {
+		tx.exec("DELETE FROM tips WHERE id = ?", n)
+	}
+}
+
+//GetP2c gets the parent to child edges
+func (tx *SQLTx) GetP2c(id uint64) []uint64 {
+	n, ok := sqlID(id)
+	if !ok {
+		return nil
+	}
+
+	return tx.getEdges("parent", "child", n)
+}
+
+//SetP2c sets the parent to child edges
+func (tx *SQLTx) SetP2c(id uint64, p2c []uint64) {
+	tx.setEdges("parent", "child", tx.id(id), p2c)
+}
+
+//GetC2p gets the child to parent edges
+func (tx *SQLTx) GetC2p(id uint64) []uint64 {
+	n, ok := sqlID(id)
+	if !ok {
+		return nil
+	}
+
+	return tx.getEdges("child", "parent", n)
+}
+
+//SetC2p sets the child to parent edges
+func (tx *SQLTx) SetC2p(id uint64, c2p []uint64) {
+	tx.setEdges("child", "parent", tx.id(id), c2p)
+}
+
+//getEdges returns the list of block 'n' on the 'from' side of its edges
+func (tx *SQLTx) getEdges(from, to string, n int64) []uint64 {
+	return tx.queryIDs(fmt.Sprintf("SELECT %[2]s FROM edges WHERE %[1]s = ? AND %[2]s_pos IS NOT NULL ORDER BY %[2]s_pos", from, to), n)
+}
+
+//setEdges sets the list of block 'n' on the 'from' side of its edges. Only the
+//positions after the part that is stored already are written, so appending an
+//edge doesn't rewrite the whole list.
+func (tx *SQLTx) setEdges(from, to string, n int64, ids []uint64) {
+	stored := tx.getEdges(from, to, n)
+	k := 0
+	for k < len(stored) && k < len(ids) && stored[k] == ids[k] {
+		k++
+	}
+
+	if k < len(stored) {
+		tx.delEdges(from, to, n, k)
+	}
+
+	q := "UPDATE edges SET %[2]s_pos = ? WHERE rowid = (SELECT rowid FROM edges WHERE %[1]s = ? AND %[2]s = ? AND %[2]s_pos IS NULL LIMIT 1)"
+	for i := k; i < len(ids); i++ {
+		//the edge has a row already if it is in the list of the other block
+		if tx.exec(fmt.Sprintf(q, from, to), i, n, tx.id(ids[i])) > 0 {
+			continue
+		}
+
+		tx.exec(fmt.Sprintf("INSERT INTO edges (%[1]s, %[2]s, %[2]s_pos) VALUES (?, ?, ?)", from, to), n, tx.id(ids[i]), i)
+	}
+}
+
+//delEdges removes the edges from position 'pos' onwards from the list of block
+//'n' on the 'from' side, rows are deleted when the edge isn't in the list of
+//the other block either
+func (tx *SQLTx) delEdges(from, to string, n int64, pos int) {
+	tx.exec(fmt.Sprintf("UPDATE edges SET %[2]s_pos = NULL WHERE %[1]s = ? AND %[2]s_pos >= ?", from, to), n, pos)
+	tx.exec(fmt.Sprintf("DELETE FROM edges WHERE %s = ? AND parent_pos IS NULL AND child_pos IS NULL", from), n)
+}
+
+//DelData deletes the block data
+func (tx *SQLTx) DelData(id uint64) {
+	if n, ok := sqlID(id); ok {
+		tx.exec("DELETE FROM blocks WHERE id = ?", n)
+	}
+}
+
+//DelMeta deletes the metadata of a block
+func (tx *SQLTx) DelMeta(id uint64) {
+	if n, ok := sqlID(id); ok {
+		tx.exec("DELETE FROM meta WHERE id = ?", n)
+	}
+}
+
+//DelP2c deletes the parent to child edges
+func (tx *SQLTx) DelP2c(id uint64) {
+	if n, ok := sqlID(id); ok {
+		tx.delEdges("parent", "child", n, 0)
+	}
+}
+
+//DelC2p deletes the child to parent edges
+func (tx *SQLTx) DelC2p(id uint64) {
+	if n, ok := sqlID(id); ok {
+		tx.delEdges("child", "parent", n, 0)
+	}
+}
+
+//GetGenesis gets the blocks the graph starts from
+func (tx *SQLTx) GetGenesis() (ids []uint64) {
+	tx.getGlobal(globalGenesis, &ids)
+	return
+}
+
+//SetGenesis sets the blocks the graph starts from
+func (tx *SQLTx) SetGenesis(ids []uint64) {
+	tx.setGlobal(globalGenesis, ids)
+}
+
+//GetSeq gets the last block id that was handed out
+func (tx *SQLTx) GetSeq() (seq uint64) {
+	tx.getGlobal(globalSeq, &seq)
+	return
+}
+
+//SetSeq sets the last block id that was handed out
+func (tx *SQLTx) SetSeq(seq uint64) {
+	tx.setGlobal(globalSeq, seq)
+}
+
+//GetConfig gets the parameters the tangle was created with
+func (tx *SQLTx) GetConfig() (c tangle.Config, ok bool) {
+	ok = tx.getGlobal(globalConfig, &c)
+	if ok && c.Genesis == nil {
+		c.Genesis = [][]byte{}
+	}
+
+	return
+}
+
+//SetConfig sets the parameters the tangle was created with
+func (tx *SQLTx) SetConfig(c tangle.Config) {
+	tx.setGlobal(globalConfig, c)
+}
+
+//Commit the transaction, or roll it back and return the first error that
+//occurred in it
+func (tx *SQLTx) Commit() (err error) {
+	if tx.done {
+		panic("transaction already committed")
+	}
+
+	tx.done = true
+	if tx.update {
+		defer tx.s.wmu.Unlock()
+	}
+
+	if tx.tx == nil {
+		return tx.err //failed to begin
+	}
+
+	if tx.err != nil {
+		tx.tx.Rollback()
+		return tx.err
+	}
+
+	if err = tx.tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %v", err)
+	}
+
+	return
+}
+
+//Discard rolls the transaction back
+func (tx *SQLTx) Discard() {
+	if tx.done {
+		panic("transaction already committed")
+	}
+
+	tx.done = true
+	if tx.update {
+		defer tx.s.wmu.Unlock()
+	}
+
+	if tx.tx != nil {
+		tx.tx.Rollback()
+	}
+}
+
+//sqlID converts a block id to a database integer, 'ok' is false if it doesn't
+//fit. Such blocks can't be stored so lookups and deletes treat them as absent.
+func sqlID(id uint64) (n int64, ok bool) {
+	return int64(id), id <= math.MaxInt64
+}
+
+//id converts the block id of a write to a database integer. Ids that don't fit
+//fail the transaction instead of wrapping around onto other blocks.
+func (tx *SQLTx) id(id uint64) int64 {
+	n, ok := sqlID(id)
+	if !ok && tx.err == nil {
+		tx.err = ErrSQLIDRange
+	}
+
+	return n
+}
+
+//exec runs a statement that writes, unless an error occurred before, and
+//returns the number of rows it affected
+func (tx *SQLTx) exec(q string, args ...interface{}) (n int64) {
+	if !tx.update {
+		panic("write in a read transaction")
+	}
+
+	if tx.err != nil {
+		return 0
+	}
+
+	res, err := tx.tx.Exec(q, args...)
+	if err == nil {
+		n, err = res.RowsAffected()
+	}
+
+	if err != nil {
+		tx.err = fmt.Errorf("failed to execute %q: %v", q, err)
+	}
+
+	return
+}
+
+//queryRow scans a single row and reports if it exists
+func (tx *SQLTx) queryRow(q string, args []interface{}, dest ...interface{}) (ok bool) {
+	if tx.err != nil {
+		return false
+	}
+
+	err := tx.tx.QueryRow(q, args...).Scan(dest...)
+	if err == sql.ErrNoRows {
+		return false
+	} else if err != nil {
+		tx.err = fmt.Errorf("failed to query %q: %v", q, err)
+		return false
+	}
+
+	return true
+}
+
+//queryIDs returns the ids in the first column of the rows, nil if there are
+//none
+func (tx *SQLTx) queryIDs(q string, args ...interface{}) (ids []uint64) {
+	if tx.err != nil {
+		return nil
+	}
+
+	rows, err := tx.tx.Query(q, args...)
+	if err != nil {
+		tx.err = fmt.Errorf("failed to query %q: %v", q, err)
+		return nil
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			tx.err = fmt.Errorf("failed to scan %q: %v", q, err)
+			return nil
+		}
+
+		ids = append(ids, uint64(id))
+	}
+
+	if err = rows.Err(); err != nil {
+		tx.err = fmt.Errorf("failed to query %q: %v", q, err)
+		return nil
+	}
+
+	return
+}
+
+//getGlobal decodes the value of a global and reports if it was set
+func (tx *SQLTx) getGlobal(key string, v interface{}) (ok bool) {
+	var data string
+	if !tx.queryRow("SELECT value FROM globals WHERE key = ?", []interface{}{key}, &data) {
+		return false
+	}
+
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		tx.err = fmt.Errorf("failed to decode %s: %v", key, err)
+		return false
+	}
+
+	return true
+}
+
+//setGlobal encodes and sets the value of a global
+func (tx *SQLTx) setGlobal(key string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic("failed to encode " + key + ": " + err.Error())
+	}
+
+	tx.exec("INSERT OR REPLACE INTO globals (key, value) VALUES (?, ?)", key, string(data))
+}
@@ -0,0 +1,107 @@
+package store_test
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/store"
+	"tangle/tangle2/storetest"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestSQL(t *testing.T) {
+	dir := t.TempDir()
+	var opened []*store.SQL
+	defer func() {
+		for _, s := range opened {
+			test.Ok(t, s.Close())
+		}
+	}()
+
+	storetest.Run(t, func() tangle.Store {
+		f, err := os.CreateTemp(dir, "sql_")
+		test.Ok(t, err)
+		test.Ok(t, f.Close())
+
+		s, err := store.OpenSQL(f.Name())
+		test.Ok(t, err)
+		opened = append(opened, s)
+		return s
+	})
+}
+
+func TestSQLTangle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tangle.db")
+	s, err := store.OpenSQL(path)
+	test.Ok(t, err)
+
+	tngl := tangle.NewTangle(s)
+	prev := tngl.Genesis()
+	for i := 0; i < 20; i++ {
+		id, err := tngl.ReceiveBlock([]byte{byte(i)}, prev...)
+		test.Ok(t, err)
+		prev = []uint64{id}
+	}
+
+	exp := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.Export(exp))
+
+	var n, height int
+	test.Ok(t, s.DB().QueryRow("SELECT count(*) FROM edges").Scan(&n))
+	test.Equals(t, 21, n) //one row per edge
+	test.Ok(t, s.DB().QueryRow("SELECT max(height) FROM meta").Scan(&height))
+	test.Equals(t, 20, height)
+	test.Ok(t, s.Close())
+
+	s, err = store.OpenSQL(path)
+	test.Ok(t, err)
+	defer s.Close()
+
+	tngl, err = tangle.OpenTangle(s)
+	test.Ok(t, err)
+	act := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.Export(act))
+	test.Equals(t, exp.String(), act.String())
+
+	id, err := tngl.ReceiveBlock([]byte("hello"), prev...)
+	test.Ok(t, err)
+	test.Equals(t, uint64(23), id)
+	test.Equals(t, []uint64{id}, tngl.SelectTips(1, 10))
+}
+
+func TestSQLIDRange(t *testing.T) {
+	s, err := store.OpenSQL(filepath.Join(t.TempDir(), "tangle.db"))
+	test.Ok(t, err)
+	defer s.Close()
+
+	tx := s.NewTransaction(true)
+	tx.SetMeta(1, tangle.Meta{Height: 1})
+	tx.SetP2c(1, []uint64{math.MaxInt64 + 1})
+	test.Equals(t, store.ErrSQLIDRange, tx.Commit())
+
+	//nothing was written and the id didn't wrap around onto another block
+	tx = s.NewTransaction(false)
+	_, ok := tx.GetMeta(1)
+	test.Equals(t, false, ok)
+	test.Equals(t, 0, len(tx.GetP2c(1)))
+	test.Ok(t, tx.Commit())
+
+	//such ids can't be stored, so reading them doesn't find anything
+	tx = s.NewTransaction(false)
+	_, ok = tx.GetMeta(math.MaxUint64)
+	test.Equals(t, false, ok)
+	_, ok = tx.GetData(math.MaxUint64)
+	test.Equals(t, false, ok)
+	test.Equals(t, 0, len(tx.GetP2c(math.MaxUint64)))
+	test.Equals(t, 0, len(tx.GetC2p(math.MaxUint64)))
+	test.Ok(t, tx.Commit())
+
+	tngl := tangle.NewTangle(s)
+	_, err = tngl.Block(math.MaxUint64)
+	test.Equals(t, tangle.ErrBlockNotExist, err)
+}
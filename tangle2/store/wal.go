@@ -0,0 +1,668 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	tangle "tangle/tangle2"
+)
+
+//The log is a sequence of frames, one for every committed write transaction.
+//A frame is a big-endian uint32 payload length, a crc32 of the payload and the
+//payload: the operations of the transaction. A snapshot file starts with a
+//magic value followed by frames that recreate the state when it was written.
+//Operations set or delete values as a whole, so replaying a log on top of the
+//snapshot it was compacted into results in the same state.
+const (
+	walLogFile   = "wal.log"
+	walSnapFile  = "wal.snapshot"
+	walSnapMagic = "TNGLWAL\x01"
+
+	walFrameHeader = 8        //length and checksum
+	walFrameTarget = 64 << 10 //start a new snapshot frame when exceeding this size
+)
+
+//operations that are recorded in the log
+const (
+	opSetMeta = iota + 1
+	opSetData
+	opSetTip
+	opDelTip
+	opSetP2c
+	opSetC2p
+	opDelData
+	opDelMeta
+	opDelP2c
+	opDelC2p
+	opSetGenesis
+	opSetSeq
+	opSetConfig
+)
+
+var (
+	//ErrWALClosed is returned when committing to a log that was closed
+	ErrWALClosed = errors.New("write-ahead log is closed")
+
+	//ErrWALCorrupt is returned when opening a log with a bad frame that is
+	//followed by frames of committed transactions
+	ErrWALCorrupt = errors.New("write-ahead log is corrupt")
+
+	//errBadFrame is returned for a frame that is incomplete or doesn't match
+	//its checksum
+	errBadFrame = errors.New("bad frame")
+)
+
+//WAL keeps the graph in memory and records every committed write transaction
+//in an append-only log that is synced to disk before the changes become
+//visible. Opening the store replays the snapshot and the log, a transaction
+//that was only partially written when the process stopped is ignored. Opening
+//fails with ErrWALCorrupt if a bad frame is followed by valid ones, those
+//transactions were committed so the log is left as it is.
+type WAL struct {
+	mem  *Simple
+	dir  string
+	log  *os.File //nil when closed
+	size int64    //bytes of the log that hold complete frames
+}
+
+//OpenWAL opens the log in directory 'dir', creating it if it doesn't exist
+func OpenWAL(dir string) (w *WAL, err error) {
+	if err = os.MkdirAll(dir, 0777); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	w = &WAL{mem: NewSimple(), dir: dir}
+	tx := w.mem.NewTransaction(true).(*SimpleTx)
+	if err = w.loadSnapshot(tx); err != nil {
+		tx.Discard()
+		return nil, err
+	}
+
+	if err = w.replay(tx); err != nil {
+		tx.Discard()
+		if w.log != nil {
+			w.log.Close()
+		}
+
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit replayed log: %v", err)
+	}
+
+	return w, nil
+}
+
+//NewTransaction starts a store transaction, the changes of an update
+//transaction are recorded in the log when it is committed
+func (w *WAL) NewTransaction(update bool) tangle.StoreTx {
+	tx := w.mem.NewTransaction(update).(*SimpleTx)
+	if !update {
+		return tx
+	}
+
+	return &WALTx{SimpleTx: tx, w: w}
+}
+
+//NewGraphTransaction starts a transaction for when only the graph is stored
+func (w *WAL) NewGraphTransaction(update bool) tangle.GraphTx {
+	return w.NewTransaction(update)
+}
+
+//NewPayloadTransaction starts a transaction for when only payloads are stored
+func (w *WAL) NewPayloadTransaction(update bool) tangle.PayloadTx {
+	return w.NewTransaction(update)
+}
+
+//Compact writes the current state to the snapshot file and empties the log.
+//Write transactions wait for it to finish, readers don't.
+func (w *WAL) Compact() (err error) {
+	tx := w.mem.NewTransaction(true).(*SimpleTx)
+	defer tx.Discard()
+	if w.log == nil {
+		return ErrWALClosed
+	}
+
+	path := filepath.Join(w.dir, walSnapFile)
+	if err = writeWALSnapshot(path+".tmp", tx); err != nil {
+		return err
+	}
+
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %v", err)
+	}
+
+	if err = syncDir(w.dir); err != nil {
+		return err
+	}
+
+	if err = w.log.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate log: %v", err)
+	}
+
+	if err = w.log.Sync(); err != nil {
+		return fmt.Errorf("failed to sync log: %v", err)
+	}
+
+	w.size = 0
+	return
+}
+
+//Close the log, transactions that are committed afterwards fail
+func (w *WAL) Close() (err error) {
+	tx := w.mem.NewTransaction(true).(*SimpleTx)
+	defer tx.Discard()
+	if w.log == nil {
+		return nil
+	}
+
+	err = w.log.Close()
+	w.log = nil
+	if err != nil {
+		return fmt.Errorf("failed to close log: %v", err)
+	}
+
+	return
+}
+
+//WALTx is a write transaction that records its operations
+type WALTx struct {
+	*SimpleTx
+	w   *WAL
+	ops opWriter
+}
+
+//SetMeta sets the metadata for a block
+func (tx *WALTx) SetMeta(id uint64, m tangle.Meta) {
+	tx.SimpleTx.SetMeta(id, m)
+	tx.ops.op(opSetMeta, id)
+	tx.ops.uvarint(m.Weight)
+	tx.ops.uvarint(m.Height)
+}
+
+//SetData sets a copy of the block data
+func (tx *WALTx) SetData(id uint64, d []byte) {
+	tx.SimpleTx.SetData(id, d)
+	tx.ops.op(opSetData, id)
+	tx.ops.bytes(d)
+}
+
+//SetTip sets the provided id as a tip
+func (tx *WALTx) SetTip(id uint64) {
+	tx.SimpleTx.SetTip(id)
+	tx.ops.op(opSetTip, id)
+}
+
+//DelTip deletes the 'id' as tip
+func (tx *WALTx) DelTip(id uint64) {
+	tx.SimpleTx.DelTip(id)
+	tx.ops.op(opDelTip, id)
+}
+
+//SetP2c sets a copy of the parent to child edges
+func (tx *WALTx) SetP2c(id uint64, p2c []uint64) {
+	tx.SimpleTx.SetP2c(id, p2c)
+	tx.ops.op(opSetP2c, id)
+	tx.ops.ids(p2c)
+}
+
+//SetC2p sets a copy of the child to parent edges
+func (tx *WALTx) SetC2p(id uint64, c2p []uint64) {
+	tx.SimpleTx.SetC2p(id, c2p)
+	tx.ops.op(opSetC2p, id)
+	tx.ops.ids(c2p)
+}
+
+//DelData deletes the block data
+func (tx *WALTx) DelData(id uint64) {
+	tx.SimpleTx.DelData(id)
+	tx.ops.op(opDelData, id)
+}
+
+//DelMeta deletes the metadata of a block
+func (tx *WALTx) DelMeta(id uint64) {
+	tx.SimpleTx.DelMeta(id)
+	tx.ops.op(opDelMeta, id)
+}
+
+//DelP2c deletes the parent to child edges
+func (tx *WALTx) DelP2c(id uint64) {
+	tx.SimpleTx.DelP2c(id)
+	tx.ops.op(opDelP2c, id)
+}
+
+//DelC2p deletes the child to parent edges
+func (tx *WALTx) DelC2p(id uint64) {
+	tx.SimpleTx.DelC2p(id)
+	tx.ops.op(opDelC2p, id)
+}
+
+//SetGenesis sets a copy of the blocks the graph starts from
+func (tx *WALTx) SetGenesis(ids []uint64) {
+	tx.SimpleTx.SetGenesis(ids)
+	tx.ops.buf.WriteByte(opSetGenesis)
+	tx.ops.ids(ids)
+}
+
+//SetSeq sets the last block id that was handed out
+func (tx *WALTx) SetSeq(seq uint64) {
+	tx.SimpleTx.SetSeq(seq)
+	tx.ops.op(opSetSeq, seq)
+}
+
+//SetConfig sets the parameters the tangle was created with
+func (tx *WALTx) SetConfig(c tangle.Config) {
+	tx.SimpleTx.SetConfig(c)
+	tx.ops.config(c)
+}
+
+//Commit appends the operations to the log and syncs it, the changes only
+//become visible when that succeeded
+func (tx *WALTx) Commit() (err error) {
+	if tx.done {
+		panic("transaction already committed")
+	}
+
+	if tx.ops.buf.Len() == 0 {
+		return tx.SimpleTx.Commit()
+	}
+
+	if err = tx.w.append(tx.ops.buf.Bytes()); err != nil {
+		tx.Discard()
+		return err
+	}
+
+	return tx.SimpleTx.Commit()
+}
+
+//append writes a frame to the log, it must be called while holding the write
+//lock of the in-memory store
+func (w *WAL) append(payload []byte) (err error) {
+	if w.log == nil {
+		return ErrWALClosed
+	}
+
+	if _, err = w.log.Write(frame(payload)); err != nil {
+		w.log.Truncate(w.size) //don't leave a partial frame before the next one
+		return fmt.Errorf("failed to write log: %v", err)
+	}
+
+	if err = w.log.Sync(); err != nil {
+		w.log.Truncate(w.size)
+		return fmt.Errorf("failed to sync log: %v", err)
+	}
+
+	w.size += int64(walFrameHeader + len(payload))
+	return
+}
+
+//loadSnapshot applies the snapshot file, if there is one
+func (w *WAL) loadSnapshot(tx *SimpleTx) (err error) {
+	f, err := os.Open(filepath.Join(w.dir, walSnapFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to open snapshot: %v", err)
+	}
+
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat snapshot: %v", err)
+	}
+
+	r := bufio.NewReader(f)
+	magic := make([]byte, len(walSnapMagic))
+	if _, err = io.ReadFull(r, magic); err != nil || string(magic) != walSnapMagic {
+		return fmt.Errorf("not a write-ahead log snapshot")
+	}
+
+	for remain := fi.Size() - int64(len(magic)); ; {
+		payload, err := readFrame(r, remain)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read snapshot: %v", err) //it was renamed into place, so it must be complete
+		}
+
+		if err = applyOps(tx, payload); err != nil {
+			return fmt.Errorf("failed to apply snapshot: %v", err)
+		}
+
+		remain -= int64(walFrameHeader + len(payload))
+	}
+}
+
+//replay applies the log and truncates a last frame that wasn't completely
+//written
+func (w *WAL) replay(tx *SimpleTx) (err error) {
+	path := filepath.Join(w.dir, walLogFile)
+	if w.log, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666); err != nil {
+		return fmt.Errorf("failed to open log: %v", err)
+	}
+
+	fi, err := w.log.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat log: %v", err)
+	}
+
+	r := bufio.NewReader(w.log)
+	for {
+		payload, err := readFrame(r, fi.Size()-w.size)
+		if err == io.EOF {
+			break
+		} else if err == errBadFrame {
+			if frameAfter(w.log, w.size+1, fi.Size()) {
+				return fmt.Errorf("%v: bad frame at offset %d", ErrWALCorrupt, w.size)
+			}
+
+			if err = w.log.Truncate(w.size); err != nil {
+				return fmt.Errorf("failed to truncate torn log: %v", err)
+			}
+
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read log: %v", err)
+		}
+
+		if err = applyOps(tx, payload); err != nil {
+			return fmt.Errorf("failed to apply log at offset %d: %v", w.size, err)
+		}
+
+		w.size += int64(walFrameHeader + len(payload))
+	}
+
+	return syncDir(w.dir)
+}
+
+//writeWALSnapshot writes the state as seen by the transaction to a new file
+func writeWALSnapshot(path string, tx *SimpleTx) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(path)
+		}
+	}()
+
+	bw := bufio.NewWriter(f)
+	bw.WriteString(walSnapMagic)
+
+	var ops opWriter
+	flush := func(size int) {
+		if ops.buf.Len() > size {
+			bw.Write(frame(ops.buf.Bytes()))
+			ops.buf.Reset()
+		}
+	}
+
+	ids := tx.s.ids()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		r := tx.read(id)
+		if r.hasMeta {
+			ops.op(opSetMeta, id)
+			ops.uvarint(r.meta.Weight)
+			ops.uvarint(r.meta.Height)
+		}
+
+		if r.hasData {
+			ops.op(opSetData, id)
+			ops.bytes(r.data)
+		}
+
+		if len(r.p2c) > 0 {
+			ops.op(opSetP2c, id)
+			ops.ids(r.p2c)
+		}
+
+		if len(r.c2p) > 0 {
+			ops.op(opSetC2p, id)
+			ops.ids(r.c2p)
+		}
+
+		flush(walFrameTarget)
+	}
+
+	st := tx.readState()
+	for id := range st.tips {
+		ops.op(opSetTip, id)
+	}
+
+	ops.buf.WriteByte(opSetGenesis)
+	ops.ids(st.gen)
+	ops.op(opSetSeq, st.seq)
+	if st.cfg != nil {
+		ops.config(*st.cfg)
+	}
+
+	flush(0)
+	if err = bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %v", err)
+	}
+
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync snapshot: %v", err)
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %v", err)
+	}
+
+	return
+}
+
+//frame prefixes the payload with its length and checksum
+func frame(payload []byte) (fr []byte) {
+	fr = make([]byte, walFrameHeader, walFrameHeader+len(payload))
+	binary.BigEndian.PutUint32(fr[0:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(fr[4:], crc32.ChecksumIEEE(payload))
+	return append(fr, payload...)
+}
+
+//readFrame reads the next frame of which at most 'remain' bytes exist. It
+//returns io.EOF at the end and errBadFrame if the frame is incomplete or
+//corrupt.
+func readFrame(r io.Reader, remain int64) (payload []byte, err error) {
+	hdr := make([]byte, walFrameHeader)
+	if _, err = io.ReadFull(r, hdr); err == io.EOF {
+		return nil, io.EOF
+	} else if err == io.ErrUnexpectedEOF {
+		return nil, errBadFrame
+	} else if err != nil {
+		return nil, err
+	}
+
+	n := int64(binary.BigEndian.Uint32(hdr[0:]))
+	if n > remain-walFrameHeader {
+		return nil, errBadFrame
+	}
+
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(r, payload); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, errBadFrame
+	} else if err != nil {
+		return nil, err
+	}
+
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(hdr[4:]) {
+		return nil, errBadFrame
+	}
+
+	return
+}
+
+//frameAfter reports if a valid frame starts at or after offset 'off' of the
+//log. The length of a bad frame can't be trusted, so every offset is tried.
+//Empty frames are never written and don't count, they would match zeroes.
+func frameAfter(log io.ReaderAt, off, size int64) bool {
+	for ; off+walFrameHeader < size; off++ {
+		payload, err := readFrame(io.NewSectionReader(log, off, size-off), size-off)
+		if err == nil && len(payload) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+//applyOps applies the operations of a frame to the transaction
+func applyOps(tx *SimpleTx, payload []byte) (err error) {
+	or := &opReader{r: bytes.NewReader(payload)}
+	for or.r.Len() > 0 && or.err == nil {
+		op, _ := or.r.ReadByte()
+		switch op {
+		case opSetMeta:
+			id := or.uvarint()
+			tx.SetMeta(id, tangle.Meta{Weight: or.uvarint(), Height: or.uvarint()})
+		case opSetData:
+			id := or.uvarint()
+			tx.SetData(id, or.bytes())
+		case opSetTip:
+			tx.SetTip(or.uvarint())
+		case opDelTip:
+			tx.DelTip(or.uvarint())
+		case opSetP2c:
+			id := or.uvarint()
+			tx.SetP2c(id, or.ids())
+		case opSetC2p:
+			id := or.uvarint()
+			tx.SetC2p(id, or.ids())
+		case opDelData:
+			tx.DelData(or.uvarint())
+		case opDelMeta:
+			tx.DelMeta(or.uvarint())
+		case opDelP2c:
+			tx.DelP2c(or.uvarint())
+		case opDelC2p:
+			tx.DelC2p(or.uvarint())
+		case opSetGenesis:
+			tx.SetGenesis(or.ids())
+		case opSetSeq:
+			tx.SetSeq(or.uvarint())
+		case opSetConfig:
+			c := tangle.Config{Seed: or.varint()}
+			c.Genesis = make([][]byte, or.count())
+			for i := range c.Genesis {
+				c.Genesis[i] = or.bytes()
+			}
+
+			tx.SetConfig(c)
+		default:
+			return fmt.Errorf("unknown operation %d", op)
+		}
+	}
+
+	return or.err
+}
+
+//opWriter encodes operations
+type opWriter struct {
+	buf bytes.Buffer
+}
+
+func (ow *opWriter) op(op byte, x uint64) {
+	ow.buf.WriteByte(op)
+	ow.uvarint(x)
+}
+
+func (ow *opWriter) uvarint(x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	ow.buf.Write(b[:binary.PutUvarint(b[:], x)])
+}
+
+func (ow *opWriter) bytes(d []byte) {
+	ow.uvarint(uint64(len(d)))
+	ow.buf.Write(d)
+}
+
+func (ow *opWriter) ids(ids []uint64) {
+	ow.uvarint(uint64(len(ids)))
+	for _, id := range ids {
+		ow.uvarint(id)
+	}
+}
+
+func (ow *opWriter) config(c tangle.Config) {
+	var b [binary.MaxVarintLen64]byte
+	ow.buf.WriteByte(opSetConfig)
+	ow.buf.Write(b[:binary.PutVarint(b[:], c.Seed)])
+	ow.uvarint(uint64(len(c.Genesis)))
+	for _, d := range c.Genesis {
+		ow.bytes(d)
+	}
+}
+
+//opReader decodes operations, it stops at the first error
+type opReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (or *opReader) uvarint() (x uint64) {
+	if or.err == nil {
+		x, or.err = binary.ReadUvarint(or.r)
+	}
+
+	return
+}
+
+func (or *opReader) varint() (x int64) {
+	if or.err == nil {
+		x, or.err = binary.ReadVarint(or.r)
+	}
+
+	return
+}
+
+//count reads a number of elements that each take at least one byte
+func (or *opReader) count() (n uint64) {
+	if n = or.uvarint(); n > uint64(or.r.Len()) {
+		or.err, n = fmt.Errorf("invalid count %d", n), 0
+	}
+
+	return
+}
+
+func (or *opReader) bytes() (d []byte) {
+	d = make([]byte, or.count())
+	or.r.Read(d)
+	return
+}
+
+//ids reads edges or genesis ids, an empty list is read as nil
+func (or *opReader) ids() (ids []uint64) {
+	for n := or.count(); n > 0 && or.err == nil; n-- {
+		ids = append(ids, or.uvarint())
+	}
+
+	return
+}
+
+//syncDir makes renames and newly created files in the directory durable
+func syncDir(dir string) (err error) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory: %v", err)
+	}
+
+	defer d.Close()
+	if err = d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory: %v", err)
+	}
+
+	return
+}
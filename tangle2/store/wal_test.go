@@ -0,0 +1,188 @@
+package store_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tangle "tangle/tangle2"
+	"tangle/tangle2/store"
+	"tangle/tangle2/storetest"
+
+	test "github.com/advanderveer/go-test"
+)
+
+func TestWAL(t *testing.T) {
+	dir := t.TempDir()
+	var opened []*store.WAL
+	defer func() {
+		for _, w := range opened {
+			test.Ok(t, w.Close())
+		}
+	}()
+
+	storetest.Run(t, func() tangle.Store {
+		sdir, err := os.MkdirTemp(dir, "wal_")
+		test.Ok(t, err)
+		w, err := store.OpenWAL(sdir)
+		test.Ok(t, err)
+		opened = append(opened, w)
+		return w
+	})
+}
+
+//exported opens the tangle in 'dir' and exports it
+func exported(t *testing.T, dir string) string {
+	w, err := store.OpenWAL(dir)
+	test.Ok(t, err)
+	defer w.Close()
+
+	tngl, err := tangle.OpenTangle(w)
+	test.Ok(t, err)
+	buf := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.Export(buf))
+	return buf.String()
+}
+
+func TestWALReplay(t *testing.T) {
+	dir := t.TempDir()
+	w, err := store.OpenWAL(dir)
+	test.Ok(t, err)
+
+	tngl := tangle.NewTangle(w)
+	prev := tngl.Genesis()
+	for i := 0; i < 20; i++ {
+		id, err := tngl.ReceiveBlock([]byte{byte(i)}, prev...)
+		test.Ok(t, err)
+		prev = []uint64{id}
+	}
+
+	exp := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.Export(exp))
+	test.Ok(t, w.Close())
+
+	_, err = tngl.ReceiveBlock([]byte{1}, prev...)
+	test.Equals(t, "failed to commit: "+store.ErrWALClosed.Error(), err.Error())
+	test.Equals(t, exp.String(), exported(t, dir))
+
+	t.Run("torn tail", func(t *testing.T) {
+		log := filepath.Join(dir, "wal.log")
+		fi, err := os.Stat(log)
+		test.Ok(t, err)
+
+		f, err := os.OpenFile(log, os.O_WRONLY|os.O_APPEND, 0666)
+		test.Ok(t, err)
+		_, err = f.Write([]byte{0, 0, 1, 0, 0xAB, 0xCD, 0xEF, 0x01, 1, 2, 3}) //header claims 256 bytes
+		test.Ok(t, err)
+		test.Ok(t, f.Close())
+
+		test.Equals(t, exp.String(), exported(t, dir))
+
+		fi2, err := os.Stat(log)
+		test.Ok(t, err)
+		test.Equals(t, fi.Size(), fi2.Size()) //the tail was truncated
+	})
+
+	t.Run("continue after reopen", func(t *testing.T) {
+		w, err := store.OpenWAL(dir)
+		test.Ok(t, err)
+		tngl, err := tangle.OpenTangle(w)
+		test.Ok(t, err)
+
+		id, err := tngl.ReceiveBlock([]byte("hello"), prev...)
+		test.Ok(t, err)
+		test.Equals(t, uint64(23), id)
+		test.Ok(t, w.Close())
+
+		w, err = store.OpenWAL(dir)
+		test.Ok(t, err)
+		defer w.Close()
+		tngl, err = tangle.OpenTangle(w)
+		test.Ok(t, err)
+
+		b, err := tngl.Block(id)
+		test.Ok(t, err)
+		test.Equals(t, []byte("hello"), b.Data)
+		test.Equals(t, prev, b.Parents)
+	})
+}
+
+func TestWALCorruption(t *testing.T) {
+	dir := t.TempDir()
+	w, err := store.OpenWAL(dir)
+	test.Ok(t, err)
+
+	tngl := tangle.NewTangle(w)
+	prev := tngl.Genesis()
+	for i := 0; i < 10; i++ {
+		id, err := tngl.ReceiveBlock([]byte{byte(i)}, prev...)
+		test.Ok(t, err)
+		prev = []uint64{id}
+	}
+
+	exp := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.Export(exp))
+	test.Ok(t, w.Close())
+
+	log := filepath.Join(dir, "wal.log")
+	data, err := os.ReadFile(log)
+	test.Ok(t, err)
+
+	for _, off := range []int{0, len(data) / 3} { //the length of the first frame, a payload byte
+		corrupt := append([]byte{}, data...)
+		corrupt[off] ^= 0xFF
+		test.Ok(t, os.WriteFile(log, corrupt, 0666))
+
+		_, err = store.OpenWAL(dir)
+		test.Equals(t, true, strings.HasPrefix(err.Error(), store.ErrWALCorrupt.Error()))
+
+		//the committed transactions after the bad frame were not truncated
+		act, err := os.ReadFile(log)
+		test.Ok(t, err)
+		test.Equals(t, corrupt, act)
+	}
+
+	test.Ok(t, os.WriteFile(log, data, 0666))
+	test.Equals(t, exp.String(), exported(t, dir))
+}
+
+func TestWALCompact(t *testing.T) {
+	dir := t.TempDir()
+	w, err := store.OpenWAL(dir)
+	test.Ok(t, err)
+
+	tngl := tangle.NewTangle(w)
+	prev := tngl.Genesis()
+	for i := 0; i < 10; i++ {
+		id, err := tngl.ReceiveBlock([]byte{byte(i)}, prev...)
+		test.Ok(t, err)
+		prev = []uint64{id}
+	}
+
+	log := filepath.Join(dir, "wal.log")
+	before, err := os.ReadFile(log)
+	test.Ok(t, err)
+
+	compacted := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.Export(compacted))
+
+	test.Ok(t, w.Compact())
+	fi, err := os.Stat(log)
+	test.Ok(t, err)
+	test.Equals(t, int64(0), fi.Size())
+
+	_, err = tngl.ReceiveBlock([]byte{0xFF}, prev...)
+	test.Ok(t, err)
+
+	exp := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.Export(exp))
+	test.Ok(t, w.Close())
+	test.Equals(t, exp.String(), exported(t, dir))
+
+	//a crash after the snapshot was replaced, but before the log was emptied,
+	//replays the log on top of the snapshot
+	test.Ok(t, os.WriteFile(log, before, 0666))
+	test.Equals(t, compacted.String(), exported(t, dir))
+}
@@ -0,0 +1,476 @@
+//Package storetest provides a suite that tests if a store backend behaves like
+//the reference store
+package storetest
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+
+	tangle "tangle/tangle2"
+
+	test "github.com/advanderveer/go-test"
+)
+
+//Run the suite against stores created by 'factory', each call must return a
+//new empty store
+func Run(t *testing.T, factory func() tangle.Store) {
+	for _, c := range []struct {
+		name string
+		f    func(t *testing.T, s tangle.Store)
+	}{
+		{"meta", testMeta},
+		{"data", testData},
+		{"edges", testEdges},
+		{"large ids", testLargeIDs},
+		{"tips", testTips},
+		{"genesis", testGenesis},
+		{"sequence", testSeq},
+		{"config", testConfig},
+		{"commit", testCommit},
+		{"discard", testDiscard},
+		{"isolation", testIsolation},
+		{"aliasing", testAliasing},
+		{"concurrent readers", testConcurrentReaders},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) { c.f(t, factory()) })
+	}
+}
+
+//update runs 'f' in a committed write transaction
+func update(t *testing.T, s tangle.Store, f func(tx tangle.StoreTx)) {
+	tx := s.NewTransaction(true)
+	f(tx)
+	test.Ok(t, tx.Commit())
+}
+
+//view runs 'f' in a committed read transaction
+func view(t *testing.T, s tangle.Store, f func(tx tangle.StoreTx)) {
+	tx := s.NewTransaction(false)
+	f(tx)
+	test.Ok(t, tx.Commit())
+}
+
+func testMeta(t *testing.T, s tangle.Store) {
+	view(t, s, func(tx tangle.StoreTx) {
+		_, ok := tx.GetMeta(1)
+		test.Equals(t, false, ok)
+	})
+
+	update(t, s, func(tx tangle.StoreTx) {
+		tx.SetMeta(1, tangle.Meta{Weight: 3, Height: 1})
+		tx.SetMeta(2, tangle.Meta{})
+	})
+
+	view(t, s, func(tx tangle.StoreTx) {
+		m, ok := tx.GetMeta(1)
+		test.Equals(t, true, ok)
+		test.Equals(t, tangle.Meta{Weight: 3, Height: 1}, m)
+
+		_, ok = tx.GetMeta(2) //zero meta still exists
+		test.Equals(t, true, ok)
+	})
+
+	update(t, s, func(tx tangle.StoreTx) {
+		tx.SetMeta(1, tangle.Meta{Weight: 4, Height: 1})
+		tx.DelMeta(2)
+	})
+
+	view(t, s, func(tx tangle.StoreTx) {
+		m, _ := tx.GetMeta(1)
+		test.Equals(t, uint64(4), m.Weight)
+
+		_, ok := tx.GetMeta(2)
+		test.Equals(t, false, ok)
+	})
+}
+
+func testData(t *testing.T, s tangle.Store) {
+	view(t, s, func(tx tangle.StoreTx) {
+		_, ok := tx.GetData(1)
+		test.Equals(t, false, ok)
+	})
+
+	update(t, s, func(tx tangle.StoreTx) {
+		tx.SetData(1, []byte("foo"))
+		tx.SetData(2, []byte{})
+	})
+
+	view(t, s, func(tx tangle.StoreTx) {
+		d, ok := tx.GetData(1)
+		test.Equals(t, true, ok)
+		test.Equals(t, []byte("foo"), d)
+
+		d, ok = tx.GetData(2) //empty data still exists
+		test.Equals(t, true, ok)
+		test.Equals(t, 0, len(d))
+	})
+
+	update(t, s, func(tx tangle.StoreTx) { tx.DelData(1) })
+	view(t, s, func(tx tangle.StoreTx) {
+		_, ok := tx.GetData(1)
+		test.Equals(t, false, ok)
+	})
+}
+
+func testEdges(t *testing.T, s tangle.Store) {
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, 0, len(tx.GetP2c(1)))
+		test.Equals(t, 0, len(tx.GetC2p(1)))
+	})
+
+	update(t, s, func(tx tangle.StoreTx) {
+		tx.SetP2c(1, []uint64{3, 4})
+		tx.SetP2c(2, []uint64{3})
+		tx.SetC2p(3, []uint64{1, 2})
+		tx.SetC2p(4, []uint64{1})
+	})
+
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, []uint64{3, 4}, tx.GetP2c(1))
+		test.Equals(t, []uint64{3}, tx.GetP2c(2))
+		test.Equals(t, []uint64{1, 2}, tx.GetC2p(3))
+		test.Equals(t, []uint64{1}, tx.GetC2p(4))
+	})
+
+	//changing the edges of one block leaves the others alone
+	update(t, s, func(tx tangle.StoreTx) {
+		tx.SetP2c(2, append(tx.GetP2c(2), 5))
+		tx.DelP2c(1)
+		tx.DelC2p(4)
+	})
+
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, 0, len(tx.GetP2c(1)))
+		test.Equals(t, []uint64{3, 5}, tx.GetP2c(2))
+		test.Equals(t, []uint64{1, 2}, tx.GetC2p(3))
+		test.Equals(t, 0, len(tx.GetC2p(4)))
+	})
+
+	//lists can also change in the middle, grow and shrink
+	update(t, s, func(tx tangle.StoreTx) {
+		tx.SetC2p(3, []uint64{1, 6, 2})
+		tx.SetP2c(2, []uint64{5})
+	})
+
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, []uint64{1, 6, 2}, tx.GetC2p(3))
+		test.Equals(t, []uint64{5}, tx.GetP2c(2))
+	})
+
+	update(t, s, func(tx tangle.StoreTx) { tx.SetC2p(3, []uint64{2}) })
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, []uint64{2}, tx.GetC2p(3))
+		test.Equals(t, []uint64{5}, tx.GetP2c(2))
+	})
+}
+
+//testLargeIDs looks up ids beyond the signed 64 bit range, none are found
+func testLargeIDs(t *testing.T, s tangle.Store) {
+	update(t, s, func(tx tangle.StoreTx) {
+		tx.SetMeta(1, tangle.Meta{Weight: 1})
+		tx.SetData(1, []byte("foo"))
+		tx.SetP2c(1, []uint64{2})
+		tx.SetC2p(1, []uint64{2})
+	})
+
+	for _, id := range []uint64{math.MaxUint64, 1 << 63, 1<<63 + 1} {
+		view(t, s, func(tx tangle.StoreTx) {
+			_, ok := tx.GetMeta(id)
+			test.Equals(t, false, ok)
+			_, ok = tx.GetData(id)
+			test.Equals(t, false, ok)
+			test.Equals(t, 0, len(tx.GetP2c(id)))
+			test.Equals(t, 0, len(tx.GetC2p(id)))
+		})
+	}
+}
+
+func testTips(t *testing.T, s tangle.Store) {
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, 0, len(tx.GetTips()))
+	})
+
+	update(t, s, func(tx tangle.StoreTx) {
+		tx.SetTip(1)
+		tx.SetTip(2)
+		tx.SetTip(2) //setting twice keeps one tip
+	})
+
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, map[uint64]struct{}{1: {}, 2: {}}, tx.GetTips())
+	})
+
+	update(t, s, func(tx tangle.StoreTx) {
+		tx.DelTip(1)
+		tx.DelTip(99) //deleting an unknown tip is allowed
+	})
+
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, map[uint64]struct{}{2: {}}, tx.GetTips())
+	})
+}
+
+func testGenesis(t *testing.T, s tangle.Store) {
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, 0, len(tx.GetGenesis()))
+	})
+
+	update(t, s, func(tx tangle.StoreTx) { tx.SetGenesis([]uint64{1, 2}) })
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, []uint64{1, 2}, tx.GetGenesis())
+	})
+
+	update(t, s, func(tx tangle.StoreTx) { tx.SetGenesis([]uint64{5}) })
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, []uint64{5}, tx.GetGenesis())
+	})
+}
+
+func testSeq(t *testing.T, s tangle.Store) {
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, uint64(0), tx.GetSeq())
+	})
+
+	update(t, s, func(tx tangle.StoreTx) { tx.SetSeq(tx.GetSeq() + 10) })
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, uint64(10), tx.GetSeq())
+	})
+}
+
+func testConfig(t *testing.T, s tangle.Store) {
+	view(t, s, func(tx tangle.StoreTx) {
+		_, ok := tx.GetConfig()
+		test.Equals(t, false, ok)
+	})
+
+	cfg := tangle.Config{Seed: 7, Genesis: [][]byte{{0x01}, []byte("foo")}}
+	update(t, s, func(tx tangle.StoreTx) { tx.SetConfig(cfg) })
+	view(t, s, func(tx tangle.StoreTx) {
+		c, ok := tx.GetConfig()
+		test.Equals(t, true, ok)
+		test.Equals(t, true, cfg.Equal(c))
+	})
+}
+
+func testCommit(t *testing.T, s tangle.Store) {
+	tx := s.NewTransaction(true)
+	tx.SetData(1, []byte("foo"))
+	tx.SetMeta(1, tangle.Meta{Weight: 1})
+	tx.SetTip(1)
+
+	//the write is visible within its own transaction
+	d, _ := tx.GetData(1)
+	test.Equals(t, []byte("foo"), d)
+	test.Ok(t, tx.Commit())
+
+	//after commit the next write transaction can start and sees the changes
+	tx = s.NewTransaction(true)
+	d, _ = tx.GetData(1)
+	test.Equals(t, []byte("foo"), d)
+	test.Ok(t, tx.Commit())
+
+	//multiple read transactions can be open at the same time
+	tx1 := s.NewTransaction(false)
+	tx2 := s.NewTransaction(false)
+	_, ok1 := tx1.GetMeta(1)
+	_, ok2 := tx2.GetMeta(1)
+	test.Equals(t, true, ok1 && ok2)
+	test.Ok(t, tx1.Commit())
+	test.Ok(t, tx2.Commit())
+}
+
+func testDiscard(t *testing.T, s tangle.Store) {
+	update(t, s, func(tx tangle.StoreTx) {
+		tx.SetMeta(1, tangle.Meta{Weight: 1})
+	})
+
+	tx := s.NewTransaction(true)
+	tx.SetMeta(1, tangle.Meta{Weight: 2})
+	tx.SetData(1, []byte("foo"))
+	tx.SetTip(1)
+	tx.SetSeq(1)
+	tx.Discard()
+
+	//nothing was written and the next writer isn't blocked
+	update(t, s, func(tx tangle.StoreTx) {
+		m, _ := tx.GetMeta(1)
+		test.Equals(t, uint64(1), m.Weight)
+		_, ok := tx.GetData(1)
+		test.Equals(t, false, ok)
+		test.Equals(t, map[uint64]struct{}{}, tx.GetTips())
+		test.Equals(t, uint64(0), tx.GetSeq())
+	})
+
+	rtx := s.NewTransaction(false)
+	rtx.GetMeta(1)
+	rtx.Discard()
+}
+
+func testIsolation(t *testing.T, s tangle.Store) {
+	stop := concurrently(4, func() error {
+		//a reader sees all of a write transaction or nothing of it
+		tx := s.NewTransaction(false)
+		m1, ok1 := tx.GetMeta(1)
+		_, okd := tx.GetData(1)
+		m2, ok2 := tx.GetMeta(2)
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		if ok1 != okd || ok1 != ok2 || m1.Weight != m2.Weight {
+			return fmt.Errorf("saw part of a write: meta 1 (%v, %v), data 1 (%v), meta 2 (%v, %v)", m1, ok1, okd, m2, ok2)
+		}
+
+		return nil
+	})
+
+	for i := uint64(1); i <= 100; i++ {
+		update(t, s, func(tx tangle.StoreTx) {
+			tx.SetMeta(1, tangle.Meta{Weight: i})
+			tx.SetData(1, []byte{})
+			tx.SetMeta(2, tangle.Meta{Weight: i})
+		})
+	}
+
+	test.Ok(t, stop())
+}
+
+func testAliasing(t *testing.T, s tangle.Store) {
+	edges := make([]uint64, 1, 8) //spare capacity would be shared by appends
+	edges[0] = 2
+	gen := []uint64{1}
+	d := []byte("foo")
+	cfg := tangle.Config{Genesis: [][]byte{[]byte("bar")}}
+
+	update(t, s, func(tx tangle.StoreTx) {
+		tx.SetP2c(1, edges)
+		tx.SetC2p(2, edges)
+		tx.SetGenesis(gen)
+		tx.SetData(1, d)
+		tx.SetConfig(cfg)
+		tx.SetTip(1)
+	})
+
+	//changing what was set doesn't change the store
+	edges[0], gen[0], d[0], cfg.Genesis[0][0] = 99, 99, 'x', 'x'
+
+	//changing what was returned doesn't change the store
+	view(t, s, func(tx tangle.StoreTx) {
+		tx.GetP2c(1)[0] = 99
+		tx.GetC2p(2)[0] = 99
+		tx.GetGenesis()[0] = 99
+		c, _ := tx.GetConfig()
+		c.Genesis[0][0] = 'x'
+
+		tips := tx.GetTips()
+		delete(tips, 1)
+		tips[99] = struct{}{}
+	})
+
+	//appending to returned edges doesn't change other edges
+	update(t, s, func(tx tangle.StoreTx) {
+		base := tx.GetP2c(1)
+		tx.SetP2c(3, append(base, 3))
+		tx.SetP2c(4, append(base, 4))
+	})
+
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, []uint64{2}, tx.GetP2c(1))
+		test.Equals(t, []uint64{2}, tx.GetC2p(2))
+		test.Equals(t, []uint64{2, 3}, tx.GetP2c(3))
+		test.Equals(t, []uint64{2, 4}, tx.GetP2c(4))
+		test.Equals(t, []uint64{1}, tx.GetGenesis())
+		test.Equals(t, map[uint64]struct{}{1: {}}, tx.GetTips())
+
+		d, _ := tx.GetData(1)
+		test.Equals(t, []byte("foo"), d)
+
+		c, _ := tx.GetConfig()
+		test.Equals(t, []byte("bar"), c.Genesis[0])
+	})
+}
+
+func testConcurrentReaders(t *testing.T, s tangle.Store) {
+	stop := concurrently(4, func() error {
+		tx := s.NewTransaction(false)
+		edges := tx.GetP2c(1)
+		tips := tx.GetTips()
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		//edges are only ever appended by the writer
+		for j, id := range edges {
+			if id != uint64(100+j) {
+				return fmt.Errorf("edge %d is %d, expected %d", j, id, 100+j)
+			}
+		}
+
+		//readers own what was returned and may change it
+		for j := range edges {
+			edges[j] = 0
+		}
+
+		_ = append(edges, 0)
+		for id := range tips {
+			delete(tips, id)
+		}
+
+		return nil
+	})
+
+	for i := uint64(0); i < 200; i++ {
+		update(t, s, func(tx tangle.StoreTx) {
+			tx.SetP2c(1, append(tx.GetP2c(1), 100+i))
+			tx.SetTip(100 + i)
+		})
+	}
+
+	test.Ok(t, stop())
+
+	view(t, s, func(tx tangle.StoreTx) {
+		test.Equals(t, 200, len(tx.GetP2c(1)))
+		test.Equals(t, 200, len(tx.GetTips()))
+	})
+}
+
+//concurrently runs 'f' over and over in 'n' goroutines until stop is called,
+//which returns the first error 'f' returned. Only the test goroutine may fail
+//the test, so 'f' reports what is wrong as an error.
+func concurrently(n int, f func() error) (stop func() error) {
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				if err := f(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	return func() error {
+		close(done)
+		wg.Wait()
+		select {
+		case err := <-errs:
+			return err
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package tangle
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+//layout of the svg drawing in pixels
+const (
+	svgMargin = 20
+	svgColW   = 90
+	svgRowH   = 50
+	svgBoxW   = 50
+	svgBoxH   = 26
+)
+
+//DrawSVG draws the tangle as SVG without requiring graphviz. Blocks are placed
+//in columns from left to right by height, or by arrival if 'o.Rank' is
+//RankArrival, and spread vertically within their column.
+func (t *Tangle) DrawSVG(w io.Writer, o DrawOptions) (err error) {
+	tx := t.begin(false)
+	defer t.mustCommit(tx)
+
+	nodes, err := t.drawNodes(tx, o)
+	if err != nil {
+		return err
+	}
+
+	ew := &errWriter{w: w}
+	w = ew
+
+	boxW, boxH := svgBoxW, svgBoxH
+	if o.Labels {
+		boxW, boxH = svgBoxW+20, svgBoxH+12
+	}
+
+	//assign every block to a column
+	cols := make(map[uint64][]int)
+	var keys []uint64
+	for i, n := range nodes {
+		k := n.meta.Height
+		if o.Rank == RankArrival {
+			k = n.id
+		}
+
+		if _, ok := cols[k]; !ok {
+			keys = append(keys, k)
+		}
+
+		cols[k] = append(cols[k], i)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	var rows int
+	for _, idxs := range cols {
+		if len(idxs) > rows {
+			rows = len(idxs)
+		}
+	}
+
+	//position blocks, each column is centered vertically
+	type pos struct{ x, y int }
+	at := make(map[uint64]pos, len(nodes))
+	for c, k := range keys {
+		idxs := cols[k]
+		offset := (rows - len(idxs)) * svgRowH / 2
+		for r, i := range idxs {
+			at[nodes[i].id] = pos{
+				x: svgMargin + c*svgColW,
+				y: svgMargin + offset + r*svgRowH,
+			}
+		}
+	}
+
+	width := 2*svgMargin + boxW
+	if len(keys) > 0 {
+		width += (len(keys) - 1) * svgColW
+	}
+
+	height := 2*svgMargin + boxH
+	if rows > 0 {
+		height += (rows - 1) * svgRowH
+	}
+
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", width, height, width, height)
+	fmt.Fprintln(w, "\t"+`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto"><path d="M 0 0 L 10 5 L 0 10 z"/></marker></defs>`)
+
+	//approvals first, so blocks are drawn over them
+	for _, n := range nodes {
+		from := at[n.id]
+		for _, c := range n.children {
+			to := at[c]
+			fmt.Fprintf(w, "\t"+`<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black" marker-end="url(#arrow)"/>`+"\n",
+				from.x+boxW, from.y+boxH/2, to.x, to.y+boxH/2)
+		}
+	}
+
+	for _, n := range nodes {
+		p := at[n.id]
+		fill := n.color
+		if fill == "" {
+			fill = "white"
+		}
+
+		fmt.Fprintf(w, "\t"+`<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="black"/>`+"\n", p.x, p.y, boxW, boxH, fill)
+		if !o.Labels {
+			fmt.Fprintf(w, "\t"+`<text x="%d" y="%d" text-anchor="middle" font-family="monospace" font-size="12">%d</text>`+"\n",
+				p.x+boxW/2, p.y+boxH/2+4, n.id)
+			continue
+		}
+
+		fmt.Fprintf(w, "\t"+`<text x="%d" y="%d" text-anchor="middle" font-family="monospace" font-size="12">%d</text>`+"\n",
+			p.x+boxW/2, p.y+boxH/2-2, n.id)
+		fmt.Fprintf(w, "\t"+`<text x="%d" y="%d" text-anchor="middle" font-family="monospace" font-size="9">w:%d h:%d</text>`+"\n",
+			p.x+boxW/2, p.y+boxH/2+10, n.meta.Weight, n.meta.Height)
+	}
+
+	fmt.Fprintln(w, `</svg>`)
+	if ew.err != nil {
+		return fmt.Errorf("failed to write drawing: %v", ew.err)
+	}
+
+	return
+}
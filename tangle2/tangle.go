@@ -1,70 +1,259 @@
 package tangle
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"sort"
 	"sync/atomic"
+	"time"
+)
+
+var (
+	//ErrSnapshotEmpty is returned when a snapshot would leave no blocks behind
+	ErrSnapshotEmpty = errors.New("snapshot would leave no blocks")
 )
 
 //Tangle is our consensus data structure
 type Tangle struct {
-	graph   *Graph
-	store   Store
-	genesis []uint64
-	idc     uint64
+	graph     *Graph
+	store     Store
+	events    bus
+	metrics   *Metrics
+	confirmAt uint64
+	writer    chan struct{} //holds a token while an update transaction is open
 }
 
-//NewTangle initiates a tangle
-func NewTangle(store Store) (t *Tangle) {
-	t = &Tangle{graph: NewGraph(42), store: store}
+func newTangle(store Store, seed int64) (t *Tangle) {
+	t = &Tangle{graph: NewGraph(seed), store: store, metrics: newMetrics(), writer: make(chan struct{}, 1)}
+	t.graph.metrics = t.metrics
+	return
+}
+
+//NewTangle initiates a tangle in an empty store, the options are persisted so
+//the tangle can only be opened again with the same options. It panics if the
+//options leave no genesis blocks or with ErrTangleExists if the store already
+//holds a tangle.
+func NewTangle(store Store, opts ...Option) (t *Tangle) {
+	cfg := newConfig(opts)
+	if len(cfg.Genesis) < 1 {
+		panic("a tangle needs at least one genesis block")
+	}
+
+	t = newTangle(store, cfg.Seed)
 
-	tx := t.store.NewTransaction(true)
+	tx := t.begin(true)
 	defer t.mustCommit(tx)
-	t.genesis = []uint64{ //add 2 genesis blocks
-		t.receiveBlock(tx, []byte{0x01}),
-		t.receiveBlock(tx, []byte{0x02}),
+
+	if _, ok := tx.GetConfig(); ok {
+		panic(ErrTangleExists)
+	}
+
+	tx.SetConfig(cfg)
+	var genesis []uint64
+	for _, d := range cfg.Genesis {
+		id, err := t.receiveBlock(context.Background(), tx, nil, d)
+		if err != nil {
+			panic("failed to add genesis block: " + err.Error())
+		}
+
+		genesis = append(genesis, id)
 	}
 
+	tx.SetGenesis(genesis)
+	t.onCommit(tx)
 	return
 }
 
+//OpenTangle opens the tangle that is already held by the store. It returns
+//ErrNoTangle if the store is empty and ErrConfigMismatch if the tangle was
+//created with other options than provided.
+func OpenTangle(store Store, opts ...Option) (t *Tangle, err error) {
+	tx := store.NewTransaction(false)
+	cfg, ok := tx.GetConfig()
+	tips := len(tx.GetTips())
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit: %v", err)
+	}
+
+	if !ok {
+		return nil, ErrNoTangle
+	}
+
+	if !cfg.Equal(newConfig(opts)) {
+		return nil, ErrConfigMismatch
+	}
+
+	t = newTangle(store, cfg.Seed)
+	t.metrics.tips = int64(tips)
+	return t, nil
+}
+
+//Metrics returns the metrics of tangle and store operations
+func (t *Tangle) Metrics() *Metrics {
+	return t.metrics
+}
+
 //Genesis blocks begin the tangle
 func (t *Tangle) Genesis() []uint64 {
-	return t.genesis
+	tx := t.begin(false)
+	defer t.mustCommit(tx)
+	return tx.GetGenesis()
+}
+
+//Block returns a block with its parents and metadata
+func (t *Tangle) Block(id uint64) (b Block, err error) {
+	tx := t.begin(false)
+	defer t.mustCommit(tx)
+
+	b.Meta, err = t.meta(tx, id)
+	if err != nil {
+		return b, err
+	}
+
+	b.ID = id
+	b.Data, _ = tx.GetData(id)
+	b.Parents = t.graph.Parents(tx, id)
+	return b, nil
 }
 
-//Draw the tangle, mainly for debugging purposes
-func (t *Tangle) Draw(w io.Writer) (err error) {
-	tx := t.store.NewTransaction(false)
+//Parents returns the blocks that are approved by the provided block
+func (t *Tangle) Parents(id uint64) (parents []uint64, err error) {
+	tx := t.begin(false)
 	defer t.mustCommit(tx)
 
-	fmt.Fprintln(w, `digraph {`)
-	if err := t.graph.Walk(tx, t.genesis, t.graph.RevChildrenWRS, true, func(id uint64, data []byte, m Meta, la []uint64) error {
-		fmt.Fprintf(w, "\t"+`"%d" [shape=box];`+"\n", id)
+	if _, err = t.meta(tx, id); err != nil {
+		return nil, err
+	}
+
+	return t.graph.Parents(tx, id), nil
+}
+
+//Children returns the blocks that approve the provided block
+func (t *Tangle) Children(id uint64) (children []uint64, err error) {
+	tx := t.begin(false)
+	defer t.mustCommit(tx)
+
+	if _, err = t.meta(tx, id); err != nil {
+		return nil, err
+	}
+
+	return t.graph.Children(tx, id), nil
+}
 
-		for _, l := range la {
-			fmt.Fprintf(w, "\t"+`"%d" -> "%d";`+"\n", id, l)
+func (t *Tangle) meta(tx StoreTx, id uint64) (m Meta, err error) {
+	m, ok := tx.GetMeta(id)
+	if !ok {
+		return m, ErrBlockNotExist
+	}
+
+	return
+}
+
+//Stats describe the shape of the tangle
+type Stats struct {
+	Blocks  int    `json:"blocks"`
+	Tips    int    `json:"tips"`
+	Genesis int    `json:"genesis"`
+	Height  uint64 `json:"height"`
+}
+
+//Stats returns the number of blocks, tips and genesis blocks and the height of
+//the highest block
+func (t *Tangle) Stats() (s Stats) {
+	tx := t.begin(false)
+	defer t.mustCommit(tx)
+
+	genesis := tx.GetGenesis()
+	s.Genesis = len(genesis)
+	s.Tips = len(tx.GetTips())
+	if err := t.graph.Walk(tx, genesis, t.graph.Children, false, func(id uint64, m Meta, la []uint64) error {
+		s.Blocks++
+		if m.Height > s.Height {
+			s.Height = m.Height
 		}
 
 		return nil
 	}); err != nil {
-		return fmt.Errorf("failed to walk: %v", err)
+		panic("failed to walk for stats: " + err.Error())
 	}
 
-	fmt.Fprintln(w, `}`)
+	return
+}
+
+//Snapshot prunes all blocks below the provided height. The solid entry points
+//that are left become the new genesis blocks from which the tangle continues.
+//SnapshotAt cuts at a milestone block instead.
+func (t *Tangle) Snapshot(height uint64) (entries []uint64, err error) {
+	tx := t.begin(true)
+	defer t.mustCommit(tx)
+
+	entries = t.graph.Prune(tx, tx.GetGenesis(), height)
+	if len(entries) == 0 {
+		return nil, ErrSnapshotEmpty
+	}
+
+	tx.SetGenesis(entries)
+	t.onCommit(tx)
+	return
+}
+
+//SnapshotAt prunes the past cone of block 'id', for example a milestone that
+//confirms all of the blocks it (in)directly approves. The blocks without parents
+//that are left, including 'id' and genesis blocks that weren't pruned, become
+//the new genesis blocks. It returns ErrBlockNotExist for an unknown block and
+//ErrSnapshotEmpty if 'id' approves no blocks.
+func (t *Tangle) SnapshotAt(id uint64) (entries []uint64, err error) {
+	tx := t.begin(true)
+	defer t.mustCommit(tx)
+
+	if _, err = t.meta(tx, id); err != nil {
+		return nil, err
+	}
+
+	entries = t.graph.PruneCone(tx, id)
+	if len(entries) == 0 {
+		return nil, ErrSnapshotEmpty
+	}
+
+	for _, gid := range tx.GetGenesis() {
+		if _, ok := tx.GetMeta(gid); ok {
+			entries = append(entries, gid)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i] < entries[j] })
+	tx.SetGenesis(entries)
+	t.onCommit(tx)
 	return
 }
 
 //SelectTips will peform the tip selection until we have 'n' unique or ran the
 //algorithm 'max' times whatever happens first
 func (t *Tangle) SelectTips(n, max int) (tips []uint64) {
-	tx := t.store.NewTransaction(false)
+	tips, err := t.SelectTipsContext(context.Background(), n, max)
+	if err != nil {
+		panic("failed to select tips: " + err.Error())
+	}
+
+	return
+}
+
+//SelectTipsContext performs tip selection like SelectTips but stops walking
+//once the context is done. It then releases the read transaction and returns
+//the context's error.
+func (t *Tangle) SelectTipsContext(ctx context.Context, n, max int) (tips []uint64, err error) {
+	defer t.metrics.selectTime.since(time.Now())
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	tx := t.begin(false)
 	defer t.mustCommit(tx)
-	return t.selectTips(tx, n, max)
+	return t.selectTips(ctx, tx, n, max)
 }
 
-func (t *Tangle) selectTips(tx StoreTx, n, max int) (tips []uint64) {
+func (t *Tangle) selectTips(ctx context.Context, tx StoreTx, n, max int) (tips []uint64, err error) {
 	utips := map[uint64]struct{}{}
 	for i := 0; i < max; i++ {
 		if len(utips) >= n {
@@ -72,7 +261,7 @@ func (t *Tangle) selectTips(tx StoreTx, n, max int) (tips []uint64) {
 		}
 
 		//perform a dept-first children traveral with weighted selection
-		if err := t.graph.Walk(tx, t.genesis, t.graph.RevChildrenWRS, true, func(id uint64, data []byte, m Meta, la []uint64) error {
+		if err = t.graph.WalkContext(ctx, tx, tx.GetGenesis(), t.graph.RevChildrenWRS, true, func(id uint64, m Meta, la []uint64) error {
 			//@TODO perform validation
 			//@TODO also add tips that are not completely on the front line
 			if len(la) == 0 {
@@ -81,7 +270,7 @@ func (t *Tangle) selectTips(tx StoreTx, n, max int) (tips []uint64) {
 
 			return nil
 		}); err != nil {
-			panic("failed the walk to find a tip: " + err.Error())
+			return nil, err
 		}
 	}
 
@@ -93,22 +282,90 @@ func (t *Tangle) selectTips(tx StoreTx, n, max int) (tips []uint64) {
 	return
 }
 
-//ReceiveBlock with take data and
-func (t *Tangle) ReceiveBlock(d []byte, parents ...uint64) (id uint64) {
-	tx := t.store.NewTransaction(true)
-	defer t.mustCommit(tx)
-	return t.receiveBlock(tx, d, parents...)
+//ReceiveBlock with take data and the parents it approves and add it to the
+//tangle. It returns ErrParentNotExist if any of the parents is unknown.
+func (t *Tangle) ReceiveBlock(d []byte, parents ...uint64) (id uint64, err error) {
+	return t.ReceiveBlockContext(context.Background(), d, parents...)
 }
 
-func (t *Tangle) receiveBlock(tx StoreTx, d []byte, parents ...uint64) (id uint64) {
+//ReceiveBlockContext adds a block like ReceiveBlock but gives up with the
+//context's error if it is done while waiting for another writer of this tangle
+//or while updating weights. Nothing is written in that case.
+func (t *Tangle) ReceiveBlockContext(ctx context.Context, d []byte, parents ...uint64) (id uint64, err error) {
+	defer t.metrics.receiveTime.since(time.Now())
+
+	var evs []Event
+	tx, err := t.beginContext(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err = t.receiveBlock(ctx, tx, t.collect(&evs), d, parents...)
+	if err != nil {
+		tx.Discard()
+		return 0, err
+	}
+
+	t.onCommit(tx, evs...)
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit: %v", err)
+	}
+
+	atomic.AddUint64(&t.metrics.blocksReceived, 1)
+	return id, nil
+}
+
+//onCommit records the number of tips and publishes the events once the update
+//transaction is committed. This happens before another writer can commit, so
+//events arrive in commit order.
+func (t *Tangle) onCommit(tx *timedTx, evs ...Event) {
+	tips := int64(len(tx.GetTips()))
+	tx.committed = func() {
+		atomic.StoreInt64(&t.metrics.tips, tips)
+		t.events.publish(evs...)
+	}
+}
+
+func (t *Tangle) receiveBlock(ctx context.Context, tx StoreTx, emit func(Event), d []byte, parents ...uint64) (id uint64, err error) {
 	//@TODO add deduplication and verification
-	//@TODO this seems racy, id should probably be retrieved from storage layer
-	atomic.AddUint64(&t.idc, 1)
-	id = atomic.LoadUint64(&t.idc)
-	t.graph.Append(tx, id, d, parents...)
+	id = tx.GetSeq() + 1 //the update tx makes this safe from concurrent writers
+	if err = t.graph.append(ctx, tx, emit, id, d, parents...); err != nil {
+		return 0, err
+	}
+
+	tx.SetSeq(id)
+
 	return
 }
 
+//begin a store transaction that is timed when it is committed
+func (t *Tangle) begin(update bool) *timedTx {
+	tx, _ := t.beginContext(context.Background(), update)
+	return tx
+}
+
+//beginContext begins a store transaction, update transactions first wait for
+//other writers of this tangle to finish or the context to be done
+func (t *Tangle) beginContext(ctx context.Context, update bool) (*timedTx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	tx := &timedTx{m: t.metrics, start: time.Now()}
+	if update {
+		select {
+		case t.writer <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		tx.update, tx.writer = 1, t.writer
+	}
+
+	tx.StoreTx = t.store.NewTransaction(update)
+	return tx, nil
+}
+
 func (t *Tangle) mustCommit(tx StoreTx) {
 	err := tx.Commit()
 	if err != nil { //@TODO handle this propertly
@@ -2,11 +2,11 @@ package tangle_test
 
 import (
 	"bytes"
-	"io"
+	"context"
 	"math"
 	"math/rand"
 	"os"
-	"os/exec"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -18,6 +18,12 @@ import (
 	test "github.com/advanderveer/go-test"
 )
 
+func receive(t *testing.T, tngl *tangle.Tangle, d []byte, parents ...uint64) uint64 {
+	id, err := tngl.ReceiveBlock(d, parents...)
+	test.Ok(t, err)
+	return id
+}
+
 func TestTipSelection(t *testing.T) {
 	s := store.NewSimple()
 	tngl := tangle.NewTangle(s)
@@ -29,17 +35,293 @@ func TestTipSelection(t *testing.T) {
 	tips := tngl.SelectTips(2, 100)
 	test.Equals(t, uint64(1), tips[0])
 	test.Equals(t, uint64(2), tips[1])
+
+	_, err := tngl.ReceiveBlock([]byte{0x03}, 1, 99)
+	test.Equals(t, tangle.ErrParentNotExist, err)
+	test.Equals(t, []uint64{1, 2}, tngl.SelectTips(2, 100))
+}
+
+func TestContextCancellation(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	tips, err := tngl.SelectTipsContext(ctx, 2, 100)
+	test.Equals(t, context.DeadlineExceeded, err)
+	test.Equals(t, []uint64(nil), tips)
+
+	_, err = tngl.ReceiveBlockContext(ctx, []byte{0x03}, 1, 2)
+	test.Equals(t, context.DeadlineExceeded, err)
+	test.Equals(t, 2, tngl.Stats().Blocks)
+
+	//the transactions were released so the tangle is still usable
+	id, err := tngl.ReceiveBlockContext(context.Background(), []byte{0x03}, 1, 2)
+	test.Ok(t, err)
+
+	tips, err = tngl.SelectTipsContext(context.Background(), 1, 100)
+	test.Ok(t, err)
+	test.Equals(t, []uint64{id}, tips)
+}
+
+//gatedStore blocks update transactions until the gate is opened, once armed
+type gatedStore struct {
+	tangle.Store
+	waiting chan struct{}
+	gate    chan struct{}
+}
+
+func (s *gatedStore) NewTransaction(update bool) tangle.StoreTx {
+	if update && s.gate != nil {
+		s.waiting <- struct{}{}
+		<-s.gate
+	}
+
+	return s.Store.NewTransaction(update)
+}
+
+//countdownCtx is done after its error was checked 'n' times
+type countdownCtx struct {
+	context.Context
+	n int
+}
+
+func (c *countdownCtx) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+
+	return nil
+}
+
+func TestReceiveBlockContext(t *testing.T) {
+	t.Run("waiting for a writer", func(t *testing.T) {
+		s := &gatedStore{Store: store.NewSimple()}
+		tngl := tangle.NewTangle(s)
+		s.waiting, s.gate = make(chan struct{}, 1), make(chan struct{})
+
+		errs := make(chan error, 1)
+		go func() {
+			_, err := tngl.ReceiveBlock([]byte{0x03}, 1, 2) //holds up the next writer
+			errs <- err
+		}()
+
+		<-s.waiting
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := tngl.ReceiveBlockContext(ctx, []byte{0x04}, 1, 2)
+		test.Equals(t, context.DeadlineExceeded, err)
+
+		close(s.gate)
+		test.Ok(t, <-errs)
+		test.Equals(t, 3, tngl.Stats().Blocks)
+	})
+
+	t.Run("while updating weights", func(t *testing.T) {
+		tngl := tangle.NewTangle(store.NewSimple())
+		prev := tngl.Genesis()
+		for i := 0; i < 10; i++ {
+			prev = []uint64{receive(t, tngl, []byte{}, prev...)}
+		}
+
+		exp := bytes.NewBuffer(nil)
+		test.Ok(t, tngl.Export(exp))
+
+		ctx := &countdownCtx{Context: context.Background(), n: 5}
+		_, err := tngl.ReceiveBlockContext(ctx, []byte{0xFF}, prev...)
+		test.Equals(t, context.Canceled, err)
+
+		//nothing was written, not even the weights that were already updated
+		act := bytes.NewBuffer(nil)
+		test.Ok(t, tngl.Export(act))
+		test.Equals(t, exp.String(), act.String())
+		test.Equals(t, uint64(13), receive(t, tngl, []byte{}, prev...))
+	})
+}
+
+func TestConcurrentIDs(t *testing.T) {
+	s := store.NewSimple()
+	tngl := tangle.NewTangle(s)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	ids := map[uint64]struct{}{}
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				id, err := tngl.ReceiveBlock([]byte{}, 1, 2)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				mu.Lock()
+				ids[id] = struct{}{}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	test.Ok(t, <-errs)
+	test.Equals(t, 400, len(ids))
+
+	tx := s.NewTransaction(false)
+	defer checkCommit(t, tx)
+	test.Equals(t, uint64(402), tx.GetSeq())
 }
 
-func drawPNG(t *testing.T, buf io.Reader, name string) {
+func TestOpenTangle(t *testing.T) {
+	_, err := tangle.OpenTangle(store.NewSimple())
+	test.Equals(t, tangle.ErrNoTangle, err)
+
+	s := store.NewSimple()
+	tngl := tangle.NewTangle(s)
+	id3 := receive(t, tngl, []byte{0x03}, 1, 2)
+
+	tngl2, err := tangle.OpenTangle(s)
+	test.Ok(t, err)
+	test.Equals(t, []uint64{1, 2}, tngl2.Genesis())
+	test.Equals(t, []uint64{id3}, tngl2.SelectTips(1, 100))
+	test.Equals(t, id3+1, receive(t, tngl2, []byte{0x04}, id3))
+
+	tx := s.NewTransaction(true)
+	tx.SetConfig(tangle.Config{Seed: 42, Genesis: [][]byte{{0x01}}})
+	checkCommit(t, tx)
+
+	_, err = tangle.OpenTangle(s)
+	test.Equals(t, tangle.ErrConfigMismatch, err)
+}
+
+func TestCreateInExistingStore(t *testing.T) {
+	s := store.NewSimple()
+	tngl := tangle.NewTangle(s)
+	id3 := receive(t, tngl, []byte{0x03}, 1, 2)
+
+	snap := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.WriteSnapshot(snap))
+	exported := bytes.NewBuffer(nil)
+	test.Ok(t, tngl.Export(exported))
+
+	func() {
+		defer func() { test.Equals(t, tangle.ErrTangleExists, recover()) }()
+		tangle.NewTangle(s, tangle.WithSeed(7))
+	}()
+
+	_, err := tangle.Import(s, bytes.NewReader(exported.Bytes()))
+	test.Equals(t, tangle.ErrTangleExists, err)
+	_, err = tangle.ReadSnapshot(s, snap)
+	test.Equals(t, tangle.ErrTangleExists, err)
+
+	//the existing tangle is left as it was
+	tngl, err = tangle.OpenTangle(s)
+	test.Ok(t, err)
+	test.Equals(t, 3, tngl.Stats().Blocks)
+	test.Equals(t, id3+1, receive(t, tngl, []byte{0x04}, id3))
+}
+
+func TestTangleOptions(t *testing.T) {
+	opts := []tangle.Option{tangle.WithSeed(7), tangle.WithGenesis([]byte("a"), []byte("b"), []byte("c"))}
+	s := store.NewSimple()
+	tngl := tangle.NewTangle(s, opts...)
+	test.Equals(t, []uint64{1, 2, 3}, tngl.Genesis())
+
+	b, err := tngl.Block(3)
+	test.Ok(t, err)
+	test.Equals(t, []byte("c"), b.Data)
+
+	_, err = tangle.OpenTangle(s)
+	test.Equals(t, tangle.ErrConfigMismatch, err)
+
+	_, err = tangle.OpenTangle(s, tangle.WithSeed(7))
+	test.Equals(t, tangle.ErrConfigMismatch, err)
+
+	_, err = tangle.OpenTangle(s, opts...)
+	test.Ok(t, err)
+
+	t.Run("snapshot keeps options", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		test.Ok(t, tngl.WriteSnapshot(buf))
+
+		s2 := store.NewSimple()
+		_, err := tangle.ReadSnapshot(s2, buf)
+		test.Ok(t, err)
+
+		_, err = tangle.OpenTangle(s2, opts...)
+		test.Ok(t, err)
+	})
+
+	t.Run("genesis count", func(t *testing.T) {
+		tngl := tangle.NewTangle(store.NewSimple(), tangle.WithGenesisCount(3))
+		for i, id := range tngl.Genesis() {
+			b, err := tngl.Block(id)
+			test.Ok(t, err)
+			test.Equals(t, []byte{byte(i + 1)}, b.Data)
+		}
+
+		//the default is two numbered genesis blocks
+		s := store.NewSimple()
+		tangle.NewTangle(s)
+		_, err := tangle.OpenTangle(s, tangle.WithGenesisCount(2))
+		test.Ok(t, err)
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	s := store.NewSimple()
+	tngl := tangle.NewTangle(s)
+	id3 := receive(t, tngl, []byte{0x03}, 1, 2)
+	id4 := receive(t, tngl, []byte{0x04}, id3)
+	id5 := receive(t, tngl, []byte{0x05}, id3)
+
+	_, err := tngl.Snapshot(3)
+	test.Equals(t, tangle.ErrSnapshotEmpty, err)
+	test.Equals(t, []uint64{1, 2}, tngl.Genesis())
+
+	entries, err := tngl.Snapshot(1)
+	test.Ok(t, err)
+	test.Equals(t, []uint64{id3}, entries)
+	test.Equals(t, entries, tngl.Genesis())
+	test.Equals(t, []uint64{id4, id5}, tngl.SelectTips(2, 100))
+
+	id6 := receive(t, tngl, []byte{0x06}, id4, id5)
+	test.Equals(t, []uint64{id6}, tngl.SelectTips(1, 100))
+}
+
+func TestSnapshotAt(t *testing.T) {
+	tngl := tangle.NewTangle(store.NewSimple())
+	id3 := receive(t, tngl, []byte{0x03}, 1)
+	id4 := receive(t, tngl, []byte{0x04}, id3)
+	id5 := receive(t, tngl, []byte{0x05}, id3)
+
+	_, err := tngl.SnapshotAt(99)
+	test.Equals(t, tangle.ErrBlockNotExist, err)
+	_, err = tngl.SnapshotAt(2)
+	test.Equals(t, tangle.ErrSnapshotEmpty, err)
+
+	//the cone of the milestone is pruned, genesis 2 isn't in it
+	entries, err := tngl.SnapshotAt(id4)
+	test.Ok(t, err)
+	test.Equals(t, []uint64{2, id4, id5}, entries)
+	test.Equals(t, entries, tngl.Genesis())
+	test.Equals(t, 3, tngl.Stats().Blocks)
+
+	_, err = tngl.Block(id3)
+	test.Equals(t, tangle.ErrBlockNotExist, err)
+	id6 := receive(t, tngl, []byte{0x06}, 2, id4, id5)
+	test.Equals(t, []uint64{id6}, tngl.SelectTips(1, 100))
+}
+
+func drawSVG(t *testing.T, tngl *tangle.Tangle, name string) {
 	f, err := os.Create(name)
 	test.Ok(t, err)
 	defer f.Close()
 
-	cmd := exec.Command("dot", "-Tpng")
-	cmd.Stdin = buf
-	cmd.Stdout = f
-	test.Ok(t, cmd.Run())
+	test.Ok(t, tngl.DrawSVG(f, tangle.DrawOptions{Labels: true, Rank: tangle.RankHeight}))
 }
 
 func nextTime(rnd *rand.Rand, r float64) float64 {
@@ -74,6 +356,7 @@ func TestGraphDrawing(t *testing.T) {
 	u := time.Millisecond * 10
 
 	var wg sync.WaitGroup
+	errs := make(chan error, n)
 	for range timeline(42, n, λ, u) {
 		wg.Add(1)
 		d := time.Duration(rnd.Int63n(int64(u)))
@@ -81,16 +364,21 @@ func TestGraphDrawing(t *testing.T) {
 		go func() {
 			defer wg.Done()
 
-			tips := tngl.SelectTips(2, 100)      //find suitable tips
-			time.Sleep(d)                        //network latency
-			tngl.ReceiveBlock([]byte{}, tips...) //submit block
-
+			tips := tngl.SelectTips(2, 100)                //find suitable tips
+			time.Sleep(d)                                  //network latency
+			_, err := tngl.ReceiveBlock([]byte{}, tips...) //submit block
+			errs <- err
 		}()
 	}
 
 	wg.Wait()
-	err := tngl.Draw(buf)
-	test.Ok(t, err)
+	close(errs)
+	for err := range errs {
+		test.Ok(t, err)
+	}
+
+	test.Ok(t, tngl.Draw(buf))
+	test.Equals(t, n+2, strings.Count(buf.String(), "[shape=box"))
 
-	drawPNG(t, buf, "basic_test.png")
+	drawSVG(t, tngl, "basic_test.svg")
 }